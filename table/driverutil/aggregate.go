@@ -0,0 +1,224 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/mad-day/db-utils/table/util"
+	"bytes"
+	"strconv"
+	"fmt"
+	"io"
+)
+
+func encodeKey(buf *bytes.Buffer,vals ...interface{}) (string,error) {
+	buf.Reset()
+	if err := writeRow(buf,vals); err!=nil { return "",err }
+	return buf.String(),nil
+}
+
+// The state of an aggregate function within a group.
+type aggState struct {
+	count int64
+	isum  int64
+	fsum  float64
+	float bool
+	val   interface{}
+	seen  map[string]bool
+}
+func (s *aggState) add(a *schema.Aggregate,v interface{},buf *bytes.Buffer) error {
+	if a.Arg<0 {
+		s.count++
+		return nil
+	}
+	if v==nil { return nil }
+	if a.Distinct {
+		key,err := encodeKey(buf,v)
+		if err!=nil { return err }
+		if s.seen[key] { return nil }
+		if s.seen==nil { s.seen = make(map[string]bool) }
+		s.seen[key] = true
+	}
+	s.count++
+	switch a.Func {
+	case "sum","avg":
+		switch n := v.(type) {
+		case int64: s.isum += n
+		case float64: s.fsum += n; s.float = true
+		case bool: if n { s.isum++ }
+		case string,[]byte:
+			f,err := strconv.ParseFloat(fmt.Sprintf("%s",n),64)
+			if err!=nil { return fmt.Errorf("%s: not a number: %q",a.Func,n) }
+			s.fsum += f
+			s.float = true
+		default: return fmt.Errorf("%s: not a number: %T",a.Func,v)
+		}
+	case "min","max":
+		if s.val==nil {
+			s.val = v
+			break
+		}
+		c,err := util.Compare(v,s.val)
+		if err!=nil { return err }
+		if (a.Func=="min" && c<0) || (a.Func=="max" && c>0) { s.val = v }
+	}
+	return nil
+}
+func (s *aggState) result(a *schema.Aggregate) interface{} {
+	switch a.Func {
+	case "count": return s.count
+	case "sum":
+		if s.count==0 { return nil }
+		if s.float { return s.fsum+float64(s.isum) }
+		return s.isum
+	case "avg":
+		if s.count==0 { return nil }
+		return (s.fsum+float64(s.isum))/float64(s.count)
+	}
+	return s.val
+}
+
+type aggGroup struct {
+	key    []interface{}
+	states []aggState
+}
+
+/*
+Hash aggregation. The whole input is grouped on the first call to Next(),
+which then returns the intermediate rows, that satisfy the having clause.
+See schema.Aggregation.
+*/
+type aggIterator struct {
+	src  table.TableIterator
+	cols []int
+	agg  *schema.Aggregation
+	identity []int
+	m    util.Matcher
+
+	loaded bool
+	groups []*aggGroup
+}
+func newAggIterator(src table.TableIterator,cols []int,agg *schema.Aggregation) *aggIterator {
+	a := &aggIterator{src:src,cols:cols,agg:agg}
+	a.identity = make([]int,len(agg.GroupBy)+len(agg.Aggs))
+	for i := range a.identity { a.identity[i] = i }
+	return a
+}
+func (a *aggIterator) newGroup(key []interface{}) *aggGroup {
+	g := &aggGroup{key,make([]aggState,len(a.agg.Aggs))}
+	a.groups = append(a.groups,g)
+	return g
+}
+func (a *aggIterator) load() error {
+	defer func() { a.src.Close(); a.src = nil }()
+	var buf bytes.Buffer
+	index := make(map[string]*aggGroup)
+	vals := make([]interface{},len(a.cols))
+	key := make([]interface{},len(a.agg.GroupBy))
+	for {
+		err := a.src.Next(a.cols,vals)
+		if err==io.EOF { break }
+		if err!=nil { return err }
+		for i,p := range a.agg.GroupBy { key[i] = vals[p] }
+		k,err := encodeKey(&buf,key...)
+		if err!=nil { return err }
+		g := index[k]
+		if g==nil {
+			g = a.newGroup(append([]interface{}(nil),key...))
+			index[k] = g
+		}
+		for i := range a.agg.Aggs {
+			ag := &a.agg.Aggs[i]
+			var v interface{}
+			if ag.Arg>=0 { v = vals[ag.Arg] }
+			if err = g.states[i].add(ag,v,&buf); err!=nil { return err }
+		}
+	}
+	if len(a.agg.GroupBy)==0 && len(a.groups)==0 { a.newGroup(nil) }
+	return nil
+}
+func (a *aggIterator) Next(cols []int,vals []interface{}) error {
+	if !a.loaded {
+		a.loaded = true
+		if err := a.load(); err!=nil { return err }
+	}
+	row := make([]interface{},len(a.identity))
+	for len(a.groups)!=0 {
+		g := a.groups[0]
+		a.groups = a.groups[1:]
+		copy(row,g.key)
+		for i := range g.states {
+			row[len(g.key)+i] = g.states[i].result(&a.agg.Aggs[i])
+		}
+		ok,err := a.m.MatchPredicate(a.agg.Having,a.identity,row)
+		if err!=nil { return err }
+		if ok {
+			copy(vals,row)
+			return nil
+		}
+	}
+	return io.EOF
+}
+func (a *aggIterator) Close() (err error) {
+	if a.src!=nil { err = a.src.Close() }
+	a.groups = nil
+	return
+}
+
+// Selects the output columns from the rows of the underlying iterator, which are read as a whole.
+type projectIterator struct {
+	src    table.TableIterator
+	cols   []int
+	row    []interface{}
+	output []int
+}
+func newProjectIterator(src table.TableIterator,width int,output []int) *projectIterator {
+	return &projectIterator{src,identity(width),make([]interface{},width),output}
+}
+func (p *projectIterator) Next(cols []int,vals []interface{}) error {
+	if err := p.src.Next(p.cols,p.row); err!=nil { return err }
+	for i,j := range p.output { vals[i] = p.row[j] }
+	return nil
+}
+func (p *projectIterator) Close() error { return p.src.Close() }
+
+// Computes the result columns from the rows of the underlying iterator.
+type exprIterator struct {
+	src   table.TableIterator
+	cols  []int
+	row   []interface{}
+	exprs []*table.Expression
+	m     util.Matcher
+}
+func (e *exprIterator) Next(cols []int,vals []interface{}) error {
+	if err := e.src.Next(e.cols,e.row); err!=nil { return err }
+	for i,x := range e.exprs {
+		v,err := e.m.Eval(x,e.cols,e.row)
+		if err!=nil { return err }
+		vals[i] = v
+	}
+	return nil
+}
+func (e *exprIterator) Close() error { return e.src.Close() }
@@ -0,0 +1,61 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Aggregation over a keyTable, which can't push down anything but the key.
+func TestAggregate(t *testing.T) {
+	db, _ := openKeyDB(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select count(*), sum(qty), min(qty), max(qty) from stock", []string{"3|13|1|10"}},
+		{"select fruit, count(*), sum(qty) from stock group by fruit order by fruit",
+			[]string{"apple|2|12", "cherry|1|1"}},
+		{"select fruit, avg(qty) from stock group by fruit having count(*) > 1", []string{"apple|6"}},
+		{"select fruit from stock group by fruit order by sum(qty) desc", []string{"apple", "cherry"}},
+		{"select fruit, count(*) from stock where qty < 5 group by fruit order by fruit",
+			[]string{"apple|1", "cherry|1"}},
+		{"select fruit from stock group by fruit order by fruit limit 1 offset 1", []string{"cherry"}},
+		{"select count(*) from stock where fruit = 'kiwi'", []string{"0"}},
+		{"select f.name, count(s.id) from fruit f left join stock s on s.fruit = f.name group by f.name order by f.name",
+			[]string{"apple|2", "banana|0", "cherry|1"}},
+		// Ordering by the alias of a computed column sorts the result rows.
+		{"select qty*2 as d from stock group by qty order by d desc", []string{"20", "4", "2"}},
+		{"select fruit, 100-sum(qty) as d from stock group by fruit order by d, fruit limit 1",
+			[]string{"apple|88"}},
+		{"select fruit, sum(qty)*2 as d from stock group by fruit order by fruit desc, d",
+			[]string{"cherry|2", "apple|24"}},
+	} {
+		if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+	if _, err := db.Query("select qty*2 as d from stock group by qty order by d, count(*)"); err == nil {
+		t.Error("order by an unselected aggregate along with a computed column accepted")
+	}
+}
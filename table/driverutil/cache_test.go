@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	db, d := openTestDB(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select name from fruit -- c\nwhere qty > 4", []string{"banana", "cherry"}},
+		{"select name from fruit -- c where qty > 4", []string{"apple", "banana", "cherry"}},
+		{"select name from fruit # c\nwhere qty > 6", []string{"cherry"}},
+		{"select name from fruit # c where qty > 6", []string{"apple", "banana", "cherry"}},
+		{"select name from fruit /* c */ where qty < 4", []string{"apple"}},
+		{"select name from fruit /* c where qty < 4 */", []string{"apple", "banana", "cherry"}},
+		{"select name from fruit where name = 'a  b'", nil},
+		{"select name from fruit where name = 'a b' or qty < 4", []string{"apple"}},
+	} {
+		if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %v, want %v", c.query, got, c.want)
+		}
+	}
+
+	tab := newMemTable("name", "qty")
+	*tab.rows = [][]interface{}{{"kiwi", int64(1)}}
+	d.Sch.Put("fruit", tab)
+	if got := queryRows(t, db, "select name from fruit -- c where qty > 4"); !reflect.DeepEqual(got, []string{"kiwi"}) {
+		t.Errorf("replaced table: got %v", got)
+	}
+}
+
+// Executions of a cached statement don't share their arguments.
+func TestStmtCacheConcurrent(t *testing.T) {
+	db, _ := openTestDB(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(min int) {
+			defer wg.Done()
+			want := map[int]int{2: 3, 3: 3, 4: 2, 5: 2, 6: 1, 7: 1, 8: 0, 9: 0}[min]
+			for j := 0; j < 20; j++ {
+				rows, err := db.Query("select name from fruit where qty >= ?", min)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := 0
+				for rows.Next() {
+					n++
+				}
+				rows.Close()
+				if n != want {
+					t.Errorf("qty >= %d: %d rows, want %d", min, n, want)
+					return
+				}
+			}
+		}(i + 2)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,122 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"database/sql/driver"
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/mad-day/db-utils/table/util"
+	"reflect"
+)
+
+var anyType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Returns the column types of a table, or unknown types.
+func tableTypes(tab table.Table) []table.ColumnType {
+	if tt,ok := tab.(table.TypedTable); ok { return tt.ColumnTypes() }
+	return make([]table.ColumnType,len(tab.Columns()))
+}
+func nullable(ct table.ColumnType) table.ColumnType {
+	ct.Nullable,ct.NullableKnown = true,true
+	return ct
+}
+func typeAt(cts []table.ColumnType,i int) table.ColumnType {
+	if i<0 || i>=len(cts) { return table.ColumnType{} }
+	return cts[i]
+}
+
+// Returns the types of the intermediate row of an aggregation.
+func aggTypes(input []table.ColumnType,agg *schema.Aggregation) []table.ColumnType {
+	cts := make([]table.ColumnType,0,len(agg.GroupBy)+len(agg.Aggs))
+	for _,g := range agg.GroupBy { cts = append(cts,typeAt(input,g)) }
+	for _,a := range agg.Aggs {
+		var ct table.ColumnType
+		switch a.Func {
+		case "count": ct = util.VT_INT.ColumnType(false)
+		case "avg": ct = util.VT_FLOAT.ColumnType(true)
+		case "sum":
+			ct = util.VT_FLOAT.ColumnType(true)
+			if typeAt(input,a.Arg).ScanType==util.VT_INT.Type() { ct = util.VT_INT.ColumnType(true) }
+		default: ct = nullable(typeAt(input,a.Arg))
+		}
+		cts = append(cts,ct)
+	}
+	return cts
+}
+
+// Selects the result column types from the row types.
+func outputTypes(row []table.ColumnType,output []int,exprs []*table.Expression) []table.ColumnType {
+	if exprs!=nil {
+		cts := make([]table.ColumnType,len(exprs))
+		for i,e := range exprs {
+			if e.Op==table.E_COLUMN { cts[i] = typeAt(row,e.Index) }
+		}
+		return cts
+	}
+	cts := make([]table.ColumnType,len(output))
+	for i,p := range output { cts[i] = typeAt(row,p) }
+	return cts
+}
+
+// Returns the types of the result columns of a query.
+func queryTypes(q *schema.Query) []table.ColumnType {
+	var input []table.ColumnType
+	base := tableTypes(q.Table)
+	if len(q.Joins)!=0 {
+		input = append(input,base...)
+		for _,j := range q.Joins {
+			cts := tableTypes(j.Table)
+			for _,c := range j.Cols {
+				ct := typeAt(cts,c)
+				if j.Left { ct = nullable(ct) }
+				input = append(input,ct)
+			}
+		}
+	} else {
+		for _,c := range q.Cols { input = append(input,typeAt(base,c)) }
+	}
+	switch {
+	case q.Agg!=nil: return outputTypes(aggTypes(input,q.Agg),q.Agg.Output,q.Agg.Exprs)
+	case len(q.Joins)!=0: return outputTypes(input,q.Output,q.Exprs)
+	case q.Exprs!=nil: return outputTypes(base,nil,q.Exprs)
+	}
+	return input
+}
+
+func (t *tableResultSet) ColumnTypeScanType(index int) reflect.Type {
+	if st := typeAt(t.types,index).ScanType; st!=nil { return st }
+	return anyType
+}
+func (t *tableResultSet) ColumnTypeDatabaseTypeName(index int) string {
+	return typeAt(t.types,index).DatabaseTypeName
+}
+func (t *tableResultSet) ColumnTypeNullable(index int) (nullable, ok bool) {
+	ct := typeAt(t.types,index)
+	return ct.Nullable,ct.NullableKnown
+}
+
+var _ driver.RowsColumnTypeScanType = (*tableResultSet)(nil)
+var _ driver.RowsColumnTypeDatabaseTypeName = (*tableResultSet)(nil)
+var _ driver.RowsColumnTypeNullable = (*tableResultSet)(nil)
@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/util"
+)
+
+func TestColumns(t *testing.T) {
+	db, _ := openTestDB(t)
+	rows, err := db.Query("select name, qty from fruit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil || !reflect.DeepEqual(cols, []string{"name", "qty"}) {
+		t.Errorf("got %v, %v", cols, err)
+	}
+	if _, err := rows.ColumnTypes(); err != nil {
+		t.Error(err)
+	}
+}
+
+// The result columns carry the types of a table.TypedTable, and those of aggregates.
+func TestColumnTypes(t *testing.T) {
+	db, d := openTestDB(t)
+	d.Sch.Put("people", typedMemTable{newMemTable("name", "age"), []table.ColumnType{
+		util.VT_STRING.ColumnType(false),
+		util.VT_INT.ColumnType(true),
+	}})
+	for query, want := range map[string][]string{
+		"select name, age, age + 1 from people": {
+			"name TEXT string false", "age BIGINT int64 true", "age + 1  interface {} unknown",
+		},
+		"select name, count(*), sum(age), max(age) from people group by name": {
+			"name TEXT string false", "count(*) BIGINT int64 false", "sum(age) BIGINT int64 true", "max(age) BIGINT int64 true",
+		},
+		"select name from fruit": {"name  interface {} unknown"},
+	} {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cts, err := rows.ColumnTypes()
+		rows.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, ct := range cts {
+			null := "unknown"
+			if n, ok := ct.Nullable(); ok {
+				null = fmt.Sprint(n)
+			}
+			got = append(got, fmt.Sprintf("%s %s %v %s", ct.Name(), ct.DatabaseTypeName(), ct.ScanType(), null))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", query, got, want)
+		}
+	}
+}
+
+// A memTable, that reports the types of its columns.
+type typedMemTable struct {
+	*memTable
+	types []table.ColumnType
+}
+
+func (t typedMemTable) ColumnTypes() []table.ColumnType { return t.types }
@@ -0,0 +1,221 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mad-day/db-utils/table/driverutil"
+)
+
+func TestQuery(t *testing.T) {
+	db, _ := openTestDB(t)
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{"select name from fruit", nil, []string{"apple", "banana", "cherry"}},
+		{"select name from fruit where qty > ?", []interface{}{4}, []string{"banana", "cherry"}},
+		{"select name from fruit where qty = :q or name = :n", []interface{}{sql.Named("q", 3), sql.Named("n", "cherry")}, []string{"apple", "cherry"}},
+		{"select name from fruit where name in ::names", []interface{}{sql.Named("names", []string{"banana", "cherry"})}, []string{"banana", "cherry"}},
+		{"select name from fruit order by qty desc limit 2", nil, []string{"cherry", "banana"}},
+	} {
+		if got := queryRows(t, db, c.query, c.args...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestQueryRow(t *testing.T) {
+	db, _ := openTestDB(t)
+	var qty int64
+	if err := db.QueryRow("select qty from fruit where name = ?", "banana").Scan(&qty); err != nil || qty != 5 {
+		t.Errorf("got %d, %v", qty, err)
+	}
+	if err := db.QueryRow("select qty from fruit where name = ?", "durian").Scan(&qty); err != sql.ErrNoRows {
+		t.Errorf("got %v, want sql.ErrNoRows", err)
+	}
+	var n int64
+	if err := db.QueryRow("select count(*) from fruit").Scan(&n); err != nil || n != 3 {
+		t.Errorf("count: got %d, %v", n, err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	db, _ := openTestDB(t)
+	affected := func(res sql.Result, err error) int64 {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := affected(db.Exec("insert into fruit (name, qty) values (?, ?), (?, ?)", "durian", 1, "elder", 2)); n != 2 {
+		t.Errorf("insert: %d rows", n)
+	}
+	if _, err := db.Exec("insert into fruit values (?, ?)", "apple", 9); err == nil {
+		t.Error("insert of a duplicate key succeeded")
+	}
+	if n := affected(db.Exec("update fruit set qty = qty + 10 where qty < ?", 3)); n != 2 {
+		t.Errorf("update: %d rows", n)
+	}
+	if n := affected(db.Exec("delete from fruit where qty > 10")); n != 2 {
+		t.Errorf("delete: %d rows", n)
+	}
+	if _, err := db.Exec("select name from fruit"); err != nil {
+		t.Errorf("exec of a query: %v", err)
+	}
+	if got := queryRows(t, db, "select name from fruit"); len(got) != 3 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	db, _ := openTestDB(t)
+	stmt, err := db.Prepare("select name from fruit where qty >= ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	for _, c := range []struct {
+		min  int
+		want int
+	}{{0, 3}, {5, 2}, {8, 0}} {
+		rows, err := stmt.Query(c.min)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		rows.Close()
+		if n != c.want {
+			t.Errorf("qty >= %d: %d rows, want %d", c.min, n, c.want)
+		}
+	}
+	ins, err := db.Prepare("insert into fruit values (?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	for i, n := range []string{"fig", "grape"} {
+		if _, err := ins.Exec(n, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := queryRows(t, db, "select name from fruit where qty < 2"); !reflect.DeepEqual(got, []string{"fig", "grape"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestConn(t *testing.T) {
+	db, _ := openTestDB(t)
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "insert into fruit values (?, ?)", "kiwi", 4); err != nil {
+		t.Fatal(err)
+	}
+	var qty int64
+	if err := conn.QueryRowContext(ctx, "select qty from fruit where name = ?", "kiwi").Scan(&qty); err != nil || qty != 4 {
+		t.Errorf("got %d, %v", qty, err)
+	}
+	err = conn.Raw(func(dc interface{}) error {
+		if _, ok := dc.(*driverutil.Conn); !ok {
+			return fmt.Errorf("driver connection is %T", dc)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// The legacy driver.Stmt methods, that take positional driver.Values.
+func TestLegacyStmt(t *testing.T) {
+	_, d := openTestDB(t)
+	conn := d.NewConn()
+	defer conn.Close()
+	sel, err := conn.Prepare("select name from fruit where qty > ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sel.Close()
+	if n := sel.NumInput(); n != 1 {
+		t.Errorf("NumInput: %d", n)
+	}
+	rows, err := sel.Query([]driver.Value{int64(4)})
+	if err != nil || rows == nil {
+		t.Fatalf("Query: %v, %v", rows, err)
+	}
+	dest := make([]driver.Value, len(rows.Columns()))
+	n := 0
+	for rows.Next(dest) == nil {
+		n++
+	}
+	if err := rows.Close(); err != nil || n != 2 {
+		t.Errorf("Query: %d rows, %v", n, err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := sel.Exec([]driver.Value{int64(4)}); err != nil {
+		t.Errorf("Exec of a query: %v", err)
+	}
+
+	upd, err := conn.Prepare("update fruit set qty = ? where name = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upd.Close()
+	res, err := upd.Exec([]driver.Value{int64(1), "cherry"})
+	if err != nil || res == nil {
+		t.Fatalf("Exec: %v, %v", res, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		t.Errorf("RowsAffected: %d, %v", n, err)
+	}
+	rows, err = upd.Query([]driver.Value{int64(2), "cherry"})
+	if err != nil || rows == nil {
+		t.Fatalf("Query of an update: %v, %v", rows, err)
+	}
+	if err := rows.Next(nil); err != io.EOF {
+		t.Errorf("Query of an update: %v", err)
+	}
+	rows.Close()
+}
@@ -0,0 +1,166 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/schema"
+	"context"
+	"errors"
+)
+
+var ErrTxInProgress = errors.New("transaction already in progress")
+var ErrTxDone = sql.ErrTxDone
+var ErrDDLInTx = errors.New("DDL statements are not supported within a transaction")
+var ErrUseNeedsConn = errors.New("USE requires a connection, see Database.NewConn()")
+
+/*
+A transaction of a connection. Every TransactionalTable touched by a
+statement within the transaction is bound to a transaction of its resource,
+which is started on first use. Other tables run in auto-commit mode.
+*/
+type connTx struct {
+	conn *Conn
+	done bool
+	writable bool
+	res map[interface{}]table.Tx
+	txs []table.Tx
+}
+
+// Returns the view of 'tab' within the transaction. A nil *connTx returns 'tab'.
+func (t *connTx) bind(tab table.Table) (table.Table,error) {
+	if t==nil { return tab,nil }
+	if t.done { return nil,ErrTxDone }
+	ttab,ok := tab.(table.TransactionalTable)
+	if !ok { return tab,nil }
+	key := ttab.TxResource()
+	tx := t.res[key]
+	if tx==nil {
+		var err error
+		tx,err = ttab.TxBegin(t.writable)
+		if err!=nil { return nil,err }
+		t.res[key] = tx
+		t.txs = append(t.txs,tx)
+	}
+	return ttab.WithTx(tx)
+}
+// Statements, that were bound to the transaction, fail with ErrTxDone once it is finished.
+func (t *connTx) check() error {
+	if t!=nil && t.done { return ErrTxDone }
+	return nil
+}
+func (t *connTx) finish() error {
+	if t.done { return ErrTxDone }
+	t.done = true
+	if t.conn!=nil { t.conn.tx = nil }
+	t.conn = nil
+	return nil
+}
+func (t *connTx) Commit() error {
+	if err := t.finish(); err!=nil { return err }
+	var err error
+	for _,tx := range t.txs {
+		if err!=nil {
+			tx.Rollback()
+			continue
+		}
+		err = tx.Commit()
+	}
+	return err
+}
+func (t *connTx) Rollback() error {
+	if err := t.finish(); err!=nil { return err }
+	var err error
+	for _,tx := range t.txs {
+		if e := tx.Rollback(); err==nil { err = e }
+	}
+	return err
+}
+
+/*
+A connection to a Database. Unlike the Database itself, it supports
+transactions spanning multiple statements.
+*/
+type Conn struct {
+	db  *Database
+	tx  *connTx
+	cfg ConnConfig
+	
+	// The current schema. See USE.
+	sch *schema.Schema
+}
+func (db *Database) NewConn() *Conn {
+	sch,_ := db.schema("")
+	return &Conn{db:db,sch:sch}
+}
+func (db *Database) NewConnWith(cfg ConnConfig) (*Conn,error) {
+	sch,err := db.schema(cfg.Schema)
+	if err!=nil { return nil,err }
+	return &Conn{db:db,cfg:cfg,sch:sch},nil
+}
+
+// Switches the current schema of the connection.
+type useModifier struct {
+	conn *Conn
+	sch  *schema.Schema
+}
+func (u *useModifier) Close() error { return nil }
+func (u *useModifier) execute(ctx context.Context) (driver.Result,error) {
+	if err := ctx.Err(); err!=nil { return nil,err }
+	u.conn.sch = u.sch
+	return driver.ResultNoRows,nil
+}
+
+func (c *Conn) Close() error {
+	if c.tx!=nil { return c.tx.Rollback() }
+	return nil
+}
+func (c *Conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(),driver.TxOptions{})
+}
+func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx!=nil { return nil,ErrTxInProgress }
+	c.tx = &connTx{conn:c,writable:!(opts.ReadOnly || c.cfg.ReadOnly),res:make(map[interface{}]table.Tx)}
+	return c.tx,nil
+}
+func (c *Conn) Prepare(query string) (driver.Stmt, error) {
+	p,err := c.db.plan(query,c.sch)
+	if err!=nil { return nil,err }
+	if c.cfg.ReadOnly && !p.readOnly { return nil,ErrReadOnly }
+	if p.use!=nil && !p.explain { return &sqlModify{abstractModifier:&useModifier{c,p.use},sm:make(schema.SetterMap)},nil }
+	s,err := c.db.instantiate(p,c.tx)
+	if err!=nil { return nil,err }
+	switch v := s.(type) {
+	case *sqlSelect: v.timeout = c.cfg.Timeout
+	case *sqlModify: v.timeout = c.cfg.Timeout
+	}
+	return s,nil
+}
+func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := ctx.Err(); err!=nil { return nil,err }
+	return c.Prepare(query)
+}
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error { return c.db.CheckNamedValue(nv) }
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mad-day/db-utils/table/driverutil"
+)
+
+// Scans and modifications stop, once the context of the statement is done.
+func TestContext(t *testing.T) {
+	db, d := openTestDB(t)
+	conn := d.NewConn()
+	defer conn.Close()
+	sel, err := conn.Prepare("select name from fruit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sel.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := sel.(driver.StmtQueryContext).QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := rows.Next(dest); err != context.Canceled {
+		t.Errorf("next row after cancel: %v", err)
+	}
+	rows.Close()
+	if _, err := sel.(driver.StmtQueryContext).QueryContext(ctx, nil); err != context.Canceled {
+		t.Errorf("query with a canceled context: %v", err)
+	}
+
+	upd, err := conn.Prepare("update fruit set qty = 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upd.Close()
+	if _, err := upd.(driver.StmtExecContext).ExecContext(ctx, nil); err != context.Canceled {
+		t.Errorf("update with a canceled context: %v", err)
+	}
+	if got := queryRows(t, db, "select qty from fruit"); !reflect.DeepEqual(got, []string{"3", "5", "7"}) {
+		t.Errorf("rows updated with a canceled context: %v", got)
+	}
+
+	// ConnConfig.Timeout bounds every statement.
+	tconn, err := d.NewConnWith(driverutil.ConnConfig{Timeout: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tconn.Close()
+	tsel, err := tconn.Prepare("select name from fruit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tsel.Close()
+	rows, err = tsel.(driver.StmtQueryContext).QueryContext(context.Background(), nil)
+	if err == nil {
+		time.Sleep(20 * time.Millisecond)
+		err = rows.Next(dest)
+		rows.Close()
+	}
+	if err != context.DeadlineExceeded {
+		t.Errorf("query after the timeout: %v", err)
+	}
+}
@@ -35,17 +35,37 @@ type DbRegistry struct {
 	Rwm sync.RWMutex
 	Map map[string]*Database
 }
+// Returns the Database of a DSN, opening and registering it, if necessary.
+func (db *DbRegistry) lookup(dsn string) (*Database,*DSN,error) {
+	d,err := ParseDSN(dsn)
+	if err!=nil { return nil,nil,err }
+	db.Rwm.RLock()
+	n := db.Map[d.Name]
+	db.Rwm.RUnlock()
+	if n!=nil { return n,d,nil }
+	o,path := getOpener(d.Name)
+	if o==nil { return nil,nil,ENoDatabase }
+	db.Rwm.Lock(); defer db.Rwm.Unlock()
+	if n = db.Map[d.Name]; n==nil {
+		n,err = o(path)
+		if err!=nil { return nil,nil,err }
+		if db.Map==nil { db.Map = make(map[string]*Database) }
+		db.Map[d.Name] = n
+	}
+	return n,d,nil
+}
+
+// Opens a connection. See ParseDSN for the syntax of 'name'.
 func (db *DbRegistry) Open(name string) (driver.Conn, error) {
-	db.Rwm.RLock(); defer db.Rwm.RUnlock()
-	n := db.Map[name]
-	if n==nil { return nil,ENoDatabase }
-	return n,nil
+	n,d,err := db.lookup(name)
+	if err!=nil { return nil,err }
+	return n.NewConnWith(d.ConnConfig)
 }
 func (db *DbRegistry) OpenConnector(name string) (driver.Connector, error) {
-	db.Rwm.RLock(); defer db.Rwm.RUnlock()
-	n := db.Map[name]
-	if n==nil { return nil,ENoDatabase }
-	return &DatabaseContext{db,n},nil
+	n,d,err := db.lookup(name)
+	if err!=nil { return nil,err }
+	if _,err = n.schema(d.Schema); err!=nil { return nil,err }
+	return &DatabaseContext{db,n,d.ConnConfig},nil
 }
 func (db *DbRegistry) RegisterDb(name string,base *Database) {
 	db.Rwm.Lock(); defer db.Rwm.Unlock()
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/driverutil"
+	"github.com/mad-day/db-utils/table/schema"
+)
+
+// Creates memTables, keyed by their first column.
+type memFactory struct{}
+
+func (memFactory) CreateTable(def *schema.TableDef) (table.Table, error) {
+	var cols []string
+	for _, c := range def.Columns {
+		cols = append(cols, c.Name)
+	}
+	return newMemTable(cols...), nil
+}
+func (memFactory) DropTable(name string, tab table.Table) error { return nil }
+func (memFactory) TruncateTable(name string, tab table.Table) error {
+	*tab.(*memTable).rows = nil
+	return nil
+}
+
+func TestDDL(t *testing.T) {
+	db, d := openTestDB(t)
+	d.Sch.Factory = memFactory{}
+	for _, stmt := range []string{
+		"create table veg (name varchar(20) primary key, qty bigint)",
+		"create table if not exists veg (name varchar(20))",
+		"insert into veg values ('leek', 2), ('kale', 1)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if got := queryRows(t, db, "select name, qty from veg"); !reflect.DeepEqual(got, []string{"leek|2", "kale|1"}) {
+		t.Errorf("got %v", got)
+	}
+	if _, err := db.Exec("create table veg (name varchar(20))"); err == nil {
+		t.Error("existing table created again")
+	}
+	if _, err := db.Exec("truncate table veg"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select name from veg"); len(got) != 0 {
+		t.Errorf("after truncate: %v", got)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("drop table veg"); err != driverutil.ErrDDLInTx {
+		t.Errorf("drop within a transaction: %v", err)
+	}
+	tx.Rollback()
+
+	for _, stmt := range []string{"drop table veg", "drop table if exists veg"} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if _, err := db.Exec("drop table veg"); err == nil {
+		t.Error("drop of a missing table succeeded")
+	}
+	if _, err := db.Query("select name from veg"); err == nil {
+		t.Error("query of a dropped table succeeded")
+	}
+}
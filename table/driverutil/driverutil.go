@@ -27,34 +27,38 @@ import (
 	"database/sql/driver"
 	"github.com/mad-day/db-utils/table"
 	"github.com/mad-day/db-utils/table/schema"
+	"github.com/mad-day/db-utils/table/util"
 	"github.com/xwb1989/sqlparser"
 	"context"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 )
 
-type atx int
-func (atx) Commit() error { return nil }
-func (atx) Rollback() error { return nil }
-
 type abstractScanner interface {
-	scan() (driver.Rows,error)
+	scan(ctx context.Context) (*tableResultSet,error)
 	lng() int
 }
 
 type tableResultSet struct {
-	tab  table.Table
+	names []string
 	iter table.TableIterator
 	cols []int
 	vals []interface{}
+	types []table.ColumnType
+	cancel context.CancelFunc
 }
-func (t *tableResultSet) Columns() (s []string) {
-	mk := t.tab.Columns()
-	s = make([]string,len(t.cols))
-	for i,j := range t.cols { s[i] = mk[j] }
-	return s
+func (t *tableResultSet) Columns() (s []string) { return t.names }
+func (t *tableResultSet) Close() error {
+	if t.iter==nil { return nil }
+	if t.cancel!=nil { defer t.cancel() }
+	iter := t.iter
+	t.iter = nil
+	return iter.Close()
 }
-func (t *tableResultSet) Close() error { return t.iter.Close() }
 func (t *tableResultSet) Next(dest []driver.Value) error {
+	if t.iter==nil { return io.EOF }
 	err := t.iter.Next(t.cols, t.vals )
 	n := len(t.vals)
 	if m := len(dest) ; m<n { n = m }
@@ -63,36 +67,64 @@ func (t *tableResultSet) Next(dest []driver.Value) error {
 }
 
 type tableScanner struct {
-	tab  table.Table
-	cols []int
-	tscn *table.TableScan
+	db *Database
+	q  *schema.Query
 }
-func (t *tableScanner) lng() int { return len(t.cols) }
-func (t *tableScanner) scan() (driver.Rows,error) {
-	ti,err := t.tab.TableScan(t.cols,t.tscn)
+func (t *tableScanner) lng() int { return len(t.q.Names) }
+func (t *tableScanner) scan(ctx context.Context) (*tableResultSet,error) {
+	ti,err := t.db.query(ctx,t.q)
 	if err!=nil { return nil,err }
-	return &tableResultSet{t.tab,ti,t.cols,make([]interface{},len(t.cols))},nil
+	return &tableResultSet{t.q.Names,ti,t.q.Cols,make([]interface{},len(t.q.Names)),queryTypes(t.q),nil},nil
 }
 
 type sqlSelect struct {
 	abstractScanner
 	sm schema.SetterMap
+	timeout time.Duration
+	tx *connTx
 }
 func (s *sqlSelect) Close() error { return nil }
-func (s *sqlSelect) NumInput() int { return -1 }
-func (s *sqlSelect) Exec(args []driver.Value) (driver.Result, error) { return nil,fmt.Errorf("unsupported") }
-func (s *sqlSelect) Query(args []driver.Value) (driver.Rows, error) { return nil,nil }
+func (s *sqlSelect) NumInput() int { return len(s.sm) }
+func (s *sqlSelect) CheckNamedValue(nv *driver.NamedValue) error { return checkNamedValue(s.sm,nv) }
+func (s *sqlSelect) Exec(args []driver.Value) (driver.Result, error) {
+	nvs,err := namedValues(s.sm,args)
+	if err!=nil { return nil,err }
+	return s.ExecContext(context.Background(),nvs)
+}
+func (s *sqlSelect) Query(args []driver.Value) (driver.Rows, error) {
+	nvs,err := namedValues(s.sm,args)
+	if err!=nil { return nil,err }
+	return s.QueryContext(context.Background(),nvs)
+}
+
+// Runs the query and discards the rows.
+func (s *sqlSelect) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	rows,err := s.QueryContext(ctx,args)
+	if err!=nil { return nil,err }
+	defer rows.Close()
+	dest := make([]driver.Value,len(rows.Columns()))
+	for {
+		err = rows.Next(dest)
+		if err==io.EOF { return driver.ResultNoRows,nil }
+		if err!=nil { return nil,err }
+	}
+}
 func (s *sqlSelect) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	s.sm.Reset()
-	for _,arg := range args {
-		if s := s.sm[arg.Name]; s!=nil { s.Put(arg.Value) }
+	if err := s.tx.check(); err!=nil { return nil,err }
+	if err := bindArgs(s.sm,args); err!=nil { return nil,err }
+	ctx,cancel := withTimeout(ctx,s.timeout)
+	rows,err := s.scan(ctx)
+	if err!=nil {
+		cancel()
+		return nil,err
 	}
-	return s.scan()
+	rows.cancel = cancel
+	return rows,nil
 }
 
 type abstractModifier interface {
 	Close() error
-	execute() (driver.Result,error)
+	execute(ctx context.Context) (driver.Result,error)
 }
 
 type insertModifier struct {
@@ -100,91 +132,554 @@ type insertModifier struct {
 	meta *table.TableInsert
 }
 func (i *insertModifier) Close() error { return i.tbl.Close() }
-func (i *insertModifier) execute() (driver.Result,error) {
-	return i.tbl.TableInsert(i.meta)
+func (i *insertModifier) execute(ctx context.Context) (driver.Result,error) {
+	var m util.Matcher
+	ti,err := m.InsertValues(i.meta)
+	if err!=nil { return nil,err }
+	return util.InsertContext(ctx,i.tbl,ti)
 }
 
+/*
+Streams the result rows of the source query into the insert statement, in
+batches of Database.InsertBatchSize rows. If the query reads the target
+table itself, all rows are read, before the first one is inserted.
+*/
+type insertSelectModifier struct {
+	db   *Database
+	tbl  table.TableInsertStmt
+	is   *schema.InsertSelect
+	self bool
+}
+func (i *insertSelectModifier) Close() error { return i.tbl.Close() }
+func (i *insertSelectModifier) execute(ctx context.Context) (driver.Result,error) {
+	q := i.is.Source
+	ti,err := i.db.query(ctx,q)
+	if err!=nil { return nil,err }
+	size := i.db.InsertBatchSize
+	if size<=0 { size = DefaultInsertBatchSize }
+	var total int64
+	var lastId *int64
+	flush := func() error {
+		if len(i.is.Job.Values)==0 { return nil }
+		r,err := util.InsertContext(ctx,i.tbl,i.is.Job)
+		i.is.Job.Values = nil
+		if err!=nil { return err }
+		if r!=nil && r[1]!=nil { total += *r[1] }
+		if r!=nil && lastId==nil { lastId = r[0] }
+		return nil
+	}
+	i.is.Job.Values = nil
+	for {
+		row := make([]interface{},len(q.Names))
+		err = ti.Next(q.Cols,row)
+		if err==io.EOF { break }
+		if err==nil && !i.self && len(i.is.Job.Values)>=size { err = flush() }
+		if err!=nil {
+			ti.Close()
+			return nil,err
+		}
+		i.is.Job.Values = append(i.is.Job.Values,row)
+	}
+	if err = ti.Close(); err!=nil { return nil,err }
+	if err = flush(); err!=nil { return nil,err }
+	return &table.ModifyResult{lastId,&total},nil
+}
+
+/*
+Updates or deletes rows. Filters and predicates, the table can't evaluate
+itself, are evaluated over the scanned rows, which are sorted, if the table
+can't serve the ordering (see orderedScan). Each matching row is then
+modified on its own, identified by "=" filters on the columns, the table
+compares with "=" (see rowKey). Those should form a key of the table.
+*/
 type updateModifier struct {
+	db   *Database
+	tab  table.Table
 	tbl  table.TableUpdateStmt
 	meta *table.TableUpdate
 }
 func (i *updateModifier) Close() error { return i.tbl.Close() }
-func (i *updateModifier) execute() (driver.Result,error) {
-	return i.tbl.TableUpdate(i.meta)
+func (i *updateModifier) execute(ctx context.Context) (driver.Result,error) {
+	_,residual,where := util.SplitScan(i.tab,i.meta.Scan)
+	if len(residual)==0 && where==nil {
+		r,err := util.UpdateContext(ctx,i.tbl,i.meta)
+		if !isFilterError(err) && !isOrderError(err) { return r,err }
+	}
+	key := rowKey(i.tab)
+	if len(key)==0 { return nil,table.ErrPredicateUnsupp }
+	ti,err := i.db.orderedScan(ctx,i.tab,key,i.meta.Scan)
+	if err!=nil { return nil,err }
+	ti,err = enforceLimit(ti,i.meta.Scan)
+	if err!=nil { return nil,err }
+	var rows [][]interface{}
+	seen := make(map[string]bool)
+	for {
+		row := make([]interface{},len(key))
+		err = ti.Next(key,row)
+		if err==io.EOF { break }
+		if err!=nil {
+			ti.Close()
+			return nil,err
+		}
+		for j,v := range row { if b,ok := v.([]byte); ok { row[j] = append([]byte(nil),b...) } }
+		id := fmt.Sprintf("%#v",row)
+		if seen[id] { continue }
+		seen[id] = true
+		rows = append(rows,row)
+	}
+	if err = ti.Close(); err!=nil { return nil,err }
+	var total int64
+	for _,row := range rows {
+		job := *i.meta
+		job.Scan = &table.TableScan{Filter:make([]table.ColumnFilter,len(key))}
+		for j,c := range key {
+			op := "="
+			if row[j]==nil { op = "<=>" }
+			job.Scan.Filter[j] = table.ColumnFilter{Index:c,Operator:op,Value:row[j]}
+		}
+		r,err := util.UpdateContext(ctx,i.tbl,&job)
+		if err!=nil { return nil,err }
+		if r!=nil && r[1]!=nil { total += *r[1] }
+	}
+	return &table.ModifyResult{nil,&total},nil
+}
+
+/*
+Returns the columns, that identify a row: those, the table accepts "=" filters
+on, or every column, if the table isn't a table.ScanCapableTable.
+*/
+func rowKey(tab table.Table) []int {
+	ctab,ok := tab.(table.ScanCapableTable)
+	if !ok { return identity(len(tab.Columns())) }
+	var key []int
+	for i,c := range ctab.ScanCaps() {
+		if c.HasOperator("=") { key = append(key,i) }
+	}
+	return key
+}
+
+func isFilterError(err error) bool {
+	var code table.ErrCode
+	switch v := err.(type) {
+	case table.ScanError: code = v.ErrCode
+	case *table.ScanError: code = v.ErrCode
+	default: return false
+	}
+	switch code {
+	case table.E_FILTER_FIELD_UNSUPP,table.E_FILTER_OPERATOR_UNSUPP,table.E_FILTER_OPERATOR_FIELD: return true
+	}
+	return false
+}
+
+/*
+Runs an INSERT ... SELECT, UPDATE or DELETE on a table.TransactionalTable
+outside of a connection's transaction. Each execution binds the tables to a
+new transaction, so that the rows read are read within the transaction, that
+is written. It is committed, if the execution succeeds, and rolled back
+otherwise. No transaction is held between executions.
+*/
+type txModifier struct {
+	db  *Database
+	is  *schema.InsertSelect
+	tab table.Table
+	upd *table.TableUpdate
+}
+func (m *txModifier) Close() error { return nil }
+func (m *txModifier) execute(ctx context.Context) (driver.Result,error) {
+	tx := &connTx{writable:true,res:make(map[interface{}]table.Tx)}
+	mod,err := m.prepare(tx)
+	if err!=nil {
+		tx.Rollback()
+		return nil,err
+	}
+	r,err := mod.execute(ctx)
+	if e := mod.Close(); err==nil { err = e }
+	if err!=nil {
+		tx.Rollback()
+		return nil,err
+	}
+	if err = tx.Commit(); err!=nil { return nil,err }
+	return r,nil
+}
+func (m *txModifier) prepare(tx *connTx) (abstractModifier,error) {
+	if m.is!=nil {
+		is := *m.is
+		src,err := bindTables(is.Source,tx)
+		if err!=nil { return nil,err }
+		is.Source = src
+		tab,err := tx.bind(is.Table)
+		if err!=nil { return nil,err }
+		itab,_ := tab.(table.InsertableTable)
+		if itab==nil { return nil,fmt.Errorf("table not updatible") }
+		ti,err := itab.TablePrepareInsert(is.Job)
+		if err!=nil { return nil,err }
+		return &insertSelectModifier{m.db,ti,&is,m.is.SelfReferencing()},nil
+	}
+	tab,err := tx.bind(m.tab)
+	if err!=nil { return nil,err }
+	utab,_ := tab.(table.UpdateableTable)
+	if utab==nil { return nil,fmt.Errorf("table not updatible") }
+	tu,err := utab.TablePrepareUpdate(m.upd)
+	if err!=nil { return nil,err }
+	return &updateModifier{m.db,tab,tu,m.upd},nil
+}
+
+func isTransactional(tab table.Table) bool {
+	_,ok := tab.(table.TransactionalTable)
+	return ok
+}
+
+type ddlModifier struct {
+	sch *schema.Schema
+	ddl *schema.DDL
+}
+func (d *ddlModifier) Close() error { return nil }
+func (d *ddlModifier) execute(ctx context.Context) (driver.Result,error) {
+	if err := ctx.Err(); err!=nil { return nil,err }
+	if err := d.sch.ExecDDL(d.ddl); err!=nil { return nil,err }
+	return driver.ResultNoRows,nil
 }
 
 type sqlModify struct {
 	abstractModifier
 	sm schema.SetterMap
+	timeout time.Duration
+	tx *connTx
+}
+func (s *sqlModify) NumInput() int { return len(s.sm) }
+func (s *sqlModify) CheckNamedValue(nv *driver.NamedValue) error { return checkNamedValue(s.sm,nv) }
+func (s *sqlModify) Exec(args []driver.Value) (driver.Result, error) {
+	nvs,err := namedValues(s.sm,args)
+	if err!=nil { return nil,err }
+	return s.ExecContext(context.Background(),nvs)
+}
+func (s *sqlModify) Query(args []driver.Value) (driver.Rows, error) {
+	nvs,err := namedValues(s.sm,args)
+	if err!=nil { return nil,err }
+	return s.QueryContext(context.Background(),nvs)
+}
+
+// Executes the statement and returns an empty result set.
+func (s *sqlModify) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if _,err := s.ExecContext(ctx,args); err!=nil { return nil,err }
+	return noRows{},nil
 }
-func (s *sqlModify) NumInput() int { return -1 }
-func (s *sqlModify) Exec(args []driver.Value) (driver.Result, error) { return nil,nil }
-func (s *sqlModify) Query(args []driver.Value) (driver.Rows, error) { return nil,fmt.Errorf("unsupported") }
 func (s *sqlModify) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	s.sm.Reset()
-	for _,arg := range args {
-		if s := s.sm[arg.Name]; s!=nil { s.Put(arg.Value) }
-	}
-	return s.execute()
+	if err := s.tx.check(); err!=nil { return nil,err }
+	if err := bindArgs(s.sm,args); err!=nil { return nil,err }
+	ctx,cancel := withTimeout(ctx,s.timeout)
+	defer cancel()
+	return s.execute(ctx)
 }
 
+const DefaultInsertBatchSize = 1024
+
 type Database struct {
 	Sch schema.Schema
+
+	// The memory budget (in bytes) of a sort operation, before it spills
+	// to disk. Zero means DefaultSortBudget.
+	SortBudget int64
+
+	// The directory for temporary files. Empty means os.TempDir().
+	SortTempDir string
+	
+	// The number of rows, INSERT ... SELECT inserts at once. Zero means
+	// DefaultInsertBatchSize.
+	InsertBatchSize int
+	
+	// The number of compiled statements to cache. Zero means
+	// DefaultStmtCacheSize, a negative number disables the cache.
+	StmtCacheSize int
+	
+	/*
+	The named schemas. Connections start in Sch, unless ConnConfig.Schema
+	names one of these, and switch schemas with USE. Qualified table names
+	refer to the tables of these schemas. Sch itself is unnamed.
+	*/
+	Catalog schema.Catalog
+	
+	link sync.Once
+	cache stmtCache
 }
-func (db *Database) iPrepare(q sqlparser.Statement) (driver.Stmt,error) {
-	sm := make(schema.SetterMap)
+
+// Executes a compiled select statement.
+func (db *Database) query(ctx context.Context,q *schema.Query) (table.TableIterator,error) {
+	if len(q.Joins)!=0 { return db.joinQuery(ctx,q) }
+	if q.Agg==nil {
+		ti,err := db.orderedScan(ctx,q.Table,q.Cols,q.Scan)
+		if err!=nil { return nil,err }
+		ti,err = enforceLimit(ti,q.Scan)
+		if err!=nil || q.Exprs==nil { return ti,err }
+		return &exprIterator{src:ti,cols:q.Cols,row:make([]interface{},len(q.Cols)),exprs:q.Exprs},nil
+	}
+	scan := *q.Scan
+	scan.Limit,scan.Offset = nil,nil
+	ti,err := db.orderedScan(ctx,q.Table,q.Cols,&scan)
+	if err!=nil { return nil,err }
+	return enforceLimit(db.aggregate(ti,q.Cols,q.Agg),q.Scan)
+}
+func (db *Database) aggregate(ti table.TableIterator,cols []int,agg *schema.Aggregation) table.TableIterator {
+	ai := newAggIterator(ti,cols,agg)
+	if len(agg.Order)!=0 && !agg.OrderResult {
+		ti = newSortIterator(ai,ai.identity,agg.Order,db.SortBudget,db.SortTempDir)
+	} else {
+		ti = ai
+	}
+	if agg.Exprs!=nil {
+		ti = &exprIterator{src:ti,cols:ai.identity,row:make([]interface{},len(ai.identity)),exprs:agg.Exprs}
+	} else {
+		ti = newProjectIterator(ti,len(ai.identity),agg.Output)
+	}
+	if agg.OrderResult { ti = newSortIterator(ti,identity(len(agg.Output)),agg.Order,db.SortBudget,db.SortTempDir) }
+	return ti
+}
+func (db *Database) joinQuery(ctx context.Context,q *schema.Query) (table.TableIterator,error) {
+	ti,width,err := db.joinScan(ctx,q)
+	if err!=nil { return nil,err }
+	if q.Agg!=nil { return enforceLimit(db.aggregate(ti,identity(width),q.Agg),q.Scan) }
+	if len(q.Order)!=0 { ti = newSortIterator(ti,identity(width),q.Order,db.SortBudget,db.SortTempDir) }
+	if q.Exprs!=nil {
+		ti = &exprIterator{src:ti,cols:identity(width),row:make([]interface{},width),exprs:q.Exprs}
+	} else {
+		ti = newProjectIterator(ti,width,q.Output)
+	}
+	return enforceLimit(ti,q.Scan)
+}
+
+/*
+Performs a table scan. If the table can't serve the ordering, the rows are
+sorted by a sort operator instead.
+*/
+func (db *Database) orderedScan(ctx context.Context,tab table.Table,cols []int,scan *table.TableScan) (table.TableIterator,error) {
+	if len(scan.Order)==0 { return util.ResidualScanContext(ctx,tab,cols,scan) }
+	if orderPushable(tab,scan) {
+		ti,err := util.ResidualScanContext(ctx,tab,cols,scan)
+		if !isOrderError(err) { return ti,err }
+	}
+	unordered := *scan
+	unordered.Order = nil
+	unordered.Limit,unordered.Offset = nil,nil
+	scols := append([]int(nil),cols...)
+	for _,o := range scan.Order {
+		if indexOf(scols,o.Index)<0 { scols = append(scols,o.Index) }
+	}
+	ti,err := util.ResidualScanContext(ctx,tab,scols,&unordered)
+	if err!=nil { return nil,err }
+	return newSortIterator(ti,scols,scan.Order,db.SortBudget,db.SortTempDir),nil
+}
+/*
+A compiled statement. Plans are shared through the statement cache, so they
+are never bound or inspected themselves, only their copies.
+*/
+type plan struct {
+	readOnly bool
+	explain bool
+	
+	// The schema, the statement was compiled against.
+	sch *schema.Schema
+	
+	// The schema of a USE statement.
+	use *schema.Schema
+	
+	query *schema.Query
+	tab table.Table
+	ins *table.TableInsert
+	insSel *schema.InsertSelect
+	upd *table.TableUpdate
+	ddl *schema.DDL
+}
+func (db *Database) compile(sch *schema.Schema,q sqlparser.Statement) (*plan,error) {
+	p := &plan{readOnly:readOnlyStmt(q),sch:sch}
+	var err error
 	switch v := q.(type) {
-	case *sqlparser.Select:
+	case *sqlparser.Select: p.query,err = sch.CompileQuery(v)
+	case *sqlparser.Insert:
+		if schema.IsInsertSelect(v) {
+			p.insSel,err = sch.CompileInsertSelect(v)
+		} else {
+			p.tab,p.ins,err = sch.CompileInsert(v)
+		}
+	case *sqlparser.Update: p.tab,p.upd,err = sch.CompileUpdate(v)
+	case *sqlparser.Delete: p.tab,p.upd,err = sch.CompileDelete(v)
+	case *sqlparser.DDL: p.ddl,err = sch.CompileDDL(v)
+	case *sqlparser.Use: p.use,err = db.schema(v.DBName.String())
+	default: return nil,fmt.Errorf("unsupported query %T",q)
+	}
+	if err!=nil { return nil,err }
+	return p,nil
+}
+
+/*
+Returns the compiled statement of 'query' within the schema 'sch', from the
+statement cache if possible.
+*/
+func (db *Database) plan(query string,sch *schema.Schema) (*plan,error) {
+	key := sch.Name+"\x00"+normalizeQuery(query)
+	version := db.version()
+	if p := db.cache.get(key,version); p!=nil { return p,nil }
+	inner,explain := explainPrefix(query)
+	show,err := parseShow(inner,sch.Name)
+	if err!=nil { return nil,err }
+	if show!=nil {
+		ts := sch.Resolve(show.schema)
+		if ts==nil { return nil,fmt.Errorf("unknown schema: %s",show.schema) }
+		if show.table!="" && ts.Get(show.table)==nil { return nil,fmt.Errorf("table not found: %s",show.table) }
+		inner = show.query
+	}
+	stmt,err := sqlparser.Parse(inner)
+	if err!=nil { return nil,err }
+	if show!=nil { show.rename(stmt) }
+	p,err := db.compile(sch,stmt)
+	if err!=nil { return nil,err }
+	if explain { p.readOnly,p.explain = true,true }
+	if p.ddl!=nil { p.ddl.IfNotExists = schema.CreateIfNotExists(inner) }
+	if p.ddl==nil { db.cache.put(key,version,p,db.StmtCacheSize) }
+	return p,nil
+}
+
+// Returns a copy of the query, whose tables are bound to 'tx'. Placeholders are shared.
+func bindTables(q *schema.Query,tx *connTx) (*schema.Query,error) {
+	nq := *q
+	var err error
+	if nq.Table,err = tx.bind(q.Table); err!=nil { return nil,err }
+	if q.Joins!=nil {
+		nq.Joins = make([]*schema.Join,len(q.Joins))
+		for i,j := range q.Joins {
+			nj := *j
+			if nj.Table,err = tx.bind(j.Table); err!=nil { return nil,err }
+			nq.Joins[i] = &nj
+		}
+	}
+	return &nq,nil
+}
+
+// Binds the tables of the query to 'tx' and collects its placeholders.
+func bindQuery(q *schema.Query,tx *connTx,sm schema.SetterMap) error {
+	var err error
+	q.Table,err = tx.bind(q.Table)
+	if err!=nil { return err }
+	sm.InspectTableScanOf(q.Table,q.Scan)
+	for _,j := range q.Joins {
+		j.Table,err = tx.bind(j.Table)
+		if err!=nil { return err }
+		sm.InspectTableScanOf(j.Table,j.Scan)
+		sm.InspectPredicate(j.On)
+	}
+	sm.InspectPredicate(q.Where)
+	for _,e := range q.Exprs { sm.InspectExpression(e) }
+	if q.Agg!=nil {
+		sm.InspectPredicate(q.Agg.Having)
+		for _,e := range q.Agg.Exprs { sm.InspectExpression(e) }
+	}
+	return nil
+}
+
+/*
+Creates a statement from a copy of the plan, bound to the transaction 'tx'.
+EXPLAIN statements take no arguments, their placeholders are shown by name.
+Outside of a transaction, INSERT ... SELECT, UPDATE and DELETE statements on a
+table.TransactionalTable run each execution within a transaction of its own
+(see txModifier).
+*/
+func (db *Database) instantiate(p *plan,tx *connTx) (driver.Stmt,error) {
+	sm := make(schema.SetterMap)
+	if p.explain {
+		e := &explainer{sch:p.sch}
+		e.plan(p)
+		return &sqlSelect{abstractScanner:&explainScanner{e.rows},sm:sm},nil
+	}
+	switch {
+	case p.query!=nil:
 		{
-			tab,cols,scan,err := db.Sch.CompileSelect(v)
+			q := p.query.Clone()
+			if err := bindQuery(q,tx,sm); err!=nil { return nil,err }
+			return &sqlSelect{abstractScanner:&tableScanner{db,q},sm:sm,tx:tx},nil
+		}
+	case p.insSel!=nil:
+		{
+			is := p.insSel.Clone()
+			self := is.SelfReferencing()
+			if err := bindQuery(is.Source,tx,sm); err!=nil { return nil,err }
+			tab,err := tx.bind(is.Table)
+			if err!=nil { return nil,err }
+			itab,_ := tab.(table.InsertableTable)
+			if itab==nil { return nil,fmt.Errorf("table not updatible") }
+			sm.InspectTupleOf(tab,is.Job.OndupCols,is.Job.OndupVals)
+			if tx==nil && isTransactional(tab) { return &sqlModify{abstractModifier:&txModifier{db:db,is:is},sm:sm},nil }
+			ti,err := itab.TablePrepareInsert(is.Job)
 			if err!=nil { return nil,err }
-			sm.InspectTableScan(scan)
-			return &sqlSelect{&tableScanner{tab,cols,scan},sm},nil
+			return &sqlModify{abstractModifier:&insertSelectModifier{db,ti,is,self},sm:sm,tx:tx},nil
 		}
-	case *sqlparser.Insert:
+	case p.ins!=nil:
 		{
-			tab,job,err := db.Sch.CompileInsert(v)
+			job := p.ins.Clone()
+			tab,err := tx.bind(p.tab)
 			if err!=nil { return nil,err }
 			itab,_ := tab.(table.InsertableTable)
 			if itab==nil { return nil,fmt.Errorf("table not updatible") }
-			sm.InspectTuples(job.Values)
-			sm.InspectTuple(job.OndupVals)
+			cols := job.Cols
+			if job.AllCols { cols = nil }
+			sm.InspectTuplesOf(tab,cols,job.Values)
+			sm.InspectTupleOf(tab,job.OndupCols,job.OndupVals)
 			ti,err := itab.TablePrepareInsert(job)
 			if err!=nil { return nil,err }
-			return &sqlModify{&insertModifier{ti,job},sm},nil
+			return &sqlModify{abstractModifier:&insertModifier{ti,job},sm:sm,tx:tx},nil
 		}
-	case *sqlparser.Update,*sqlparser.Delete:
+	case p.upd!=nil:
 		{
-			var tab table.Table
-			var job *table.TableUpdate
-			var err error
-			switch vv := q.(type) {
-			case *sqlparser.Update: tab,job,err = db.Sch.CompileUpdate(vv)
-			case *sqlparser.Delete: tab,job,err = db.Sch.CompileDelete(vv)
-			}
+			job := p.upd.Clone()
+			tab,err := tx.bind(p.tab)
 			if err!=nil { return nil,err }
 			utab,_ := tab.(table.UpdateableTable)
 			if utab==nil { return nil,fmt.Errorf("table not updatible") }
-			sm.InspectTableScan(job.Scan)
-			sm.InspectTuple(job.UpdVals)
+			sm.InspectTableScanOf(tab,job.Scan)
+			sm.InspectTupleOf(tab,job.UpdCols,job.UpdVals)
+			if tx==nil && isTransactional(tab) { return &sqlModify{abstractModifier:&txModifier{db:db,tab:tab,upd:job},sm:sm},nil }
 			tu,err := utab.TablePrepareUpdate(job)
 			if err!=nil { return nil,err }
-			return &sqlModify{&updateModifier{tu,job},sm},nil
+			return &sqlModify{abstractModifier:&updateModifier{db,tab,tu,job},sm:sm,tx:tx},nil
 		}
-	default: return nil,fmt.Errorf("unsupported query %T",q)
+	case p.ddl!=nil:
+		if tx!=nil { return nil,ErrDDLInTx }
+		return &sqlModify{abstractModifier:&ddlModifier{p.sch,p.ddl},sm:sm},nil
 	}
-	panic("iPrepare")
+	return nil,fmt.Errorf("unsupported statement")
+}
+
+// Returns the schema 'name'. The empty name refers to Sch.
+func (db *Database) schema(name string) (*schema.Schema,error) {
+	db.link.Do(func() { db.Sch.Catalog = &db.Catalog })
+	if name=="" { return &db.Sch,nil }
+	if s := db.Catalog.Get(name); s!=nil { return s,nil }
+	return nil,fmt.Errorf("unknown schema: %s",name)
 }
 
+// Changes, whenever a table or schema is put or deleted.
+func (db *Database) version() uint64 { return db.Sch.Version()+db.Catalog.Version() }
+
 func (db *Database) Close() error { return nil }
+
+// A transaction, that has no effect. See Database.Begin().
+type atx int
+func (atx) Commit() error { return nil }
+func (atx) Rollback() error { return nil }
+
+/*
+Statements prepared on the Database itself run in auto-commit mode, so the
+returned transaction has no effect. For transactions spanning multiple
+statements, use a connection, see NewConn().
+*/
 func (db *Database) Begin() (driver.Tx, error) { return atx(0),nil }
 func (db *Database) Prepare(query string) (driver.Stmt, error) {
-	stmt,err := sqlparser.Parse(query)
+	sch,_ := db.schema("")
+	p,err := db.plan(query,sch)
 	if err!=nil { return nil,err }
-	return db.iPrepare(stmt)
+	if p.use!=nil && !p.explain { return nil,ErrUseNeedsConn }
+	return db.instantiate(p,nil)
 }
 func (db *Database) CheckNamedValue(nv *driver.NamedValue) error {
-	if nv.Name=="" { nv.Name = fmt.Sprintf("v%d",nv.Ordinal) }
+	nv.Name = argName(nv)
 	val,err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
 	if err!=nil { return err }
 	nv.Value = val
@@ -194,9 +689,10 @@ func (db *Database) CheckNamedValue(nv *driver.NamedValue) error {
 type DatabaseContext struct {
 	Parent driver.Driver
 	Itself *Database
+	Config ConnConfig
 }
 func (d *DatabaseContext) Connect(ctx context.Context) (driver.Conn, error) {
-	return d.Itself,nil
+	return d.Itself.NewConnWith(d.Config)
 }
 func (d *DatabaseContext) Driver() driver.Driver { return d.Parent }
 
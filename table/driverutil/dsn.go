@@ -0,0 +1,142 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/xwb1989/sqlparser"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrReadOnly = errors.New("connection is read-only")
+
+// Connection options. See ParseDSN.
+type ConnConfig struct {
+	// Reject statements, that modify data, and begin read-only transactions.
+	ReadOnly bool
+
+	// The default schema. Empty means Database.Sch.
+	Schema string
+
+	// The timeout of each statement. Zero means no timeout.
+	Timeout time.Duration
+}
+
+/*
+A parsed data source name of the form
+
+	name[?option=value&...]
+
+'Name' is either the name of a Database within the DbRegistry, or a file to be
+opened by a registered Opener, as in "ubbolt:/var/lib/app.db". The options are
+"readonly" (a boolean), "schema" and "timeout" (a duration like "5s").
+*/
+type DSN struct {
+	Name string
+	ConnConfig
+}
+func ParseDSN(dsn string) (*DSN,error) {
+	d := new(DSN)
+	d.Name = dsn
+	i := strings.IndexByte(dsn,'?')
+	if i<0 { return d,nil }
+	d.Name = dsn[:i]
+	opts,err := url.ParseQuery(dsn[i+1:])
+	if err!=nil { return nil,err }
+	for k,v := range opts {
+		val := v[len(v)-1]
+		switch k {
+		case "readonly":
+			d.ReadOnly,err = strconv.ParseBool(val)
+		case "schema":
+			d.Schema = val
+		case "timeout":
+			d.Timeout,err = time.ParseDuration(val)
+		default:
+			err = fmt.Errorf("unknown option %q",k)
+		}
+		if err!=nil { return nil,fmt.Errorf("dsn: %v",err) }
+	}
+	return d,nil
+}
+
+/*
+Opens a Database from the path of a DSN like "scheme:path". The Database is
+opened once and kept in the DbRegistry under the name "scheme:path".
+*/
+type Opener func(path string) (*Database,error)
+
+var openers struct {
+	sync.RWMutex
+	m map[string]Opener
+}
+
+// Registers an Opener for DSNs like "scheme:path".
+func RegisterOpener(scheme string,o Opener) {
+	openers.Lock(); defer openers.Unlock()
+	if openers.m==nil { openers.m = make(map[string]Opener) }
+	openers.m[scheme] = o
+}
+func getOpener(name string) (Opener,string) {
+	i := strings.IndexByte(name,':')
+	if i<0 { return nil,"" }
+	openers.RLock(); defer openers.RUnlock()
+	return openers.m[name[:i]],name[i+1:]
+}
+
+// The registry behind the "dbutils" database/sql driver.
+var DefaultRegistry = new(DbRegistry)
+
+func init() {
+	sql.Register("dbutils",DefaultRegistry)
+}
+
+// Registers the registry as database/sql driver.
+func (db *DbRegistry) Register(driverName string) {
+	sql.Register(driverName,db)
+}
+
+var _ driver.DriverContext = (*DbRegistry)(nil)
+
+// Reports, whether a statement only reads data.
+func readOnlyStmt(stmt sqlparser.Statement) bool {
+	switch stmt.(type) {
+	case *sqlparser.Select,*sqlparser.Union,*sqlparser.Show,*sqlparser.OtherRead,*sqlparser.Use: return true
+	}
+	return false
+}
+
+// Applies the statement timeout to 'ctx'.
+func withTimeout(ctx context.Context,timeout time.Duration) (context.Context,context.CancelFunc) {
+	if timeout<=0 { return ctx,func() {} }
+	return context.WithTimeout(ctx,timeout)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mad-day/db-utils/table/driverutil"
+	"github.com/mad-day/db-utils/table/schema"
+)
+
+func TestParseDSN(t *testing.T) {
+	d, err := driverutil.ParseDSN("shop?readonly=true&schema=db2&timeout=5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &driverutil.DSN{Name: "shop", ConnConfig: driverutil.ConnConfig{ReadOnly: true, Schema: "db2", Timeout: 5 * time.Second}}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+	for _, dsn := range []string{"shop?cache=1", "shop?readonly=maybe", "shop?timeout=5"} {
+		if _, err := driverutil.ParseDSN(dsn); err == nil {
+			t.Errorf("%s: no error", dsn)
+		}
+	}
+}
+
+// Databases are found by name through the "dbutils" driver, or opened by a registered Opener.
+func TestDriver(t *testing.T) {
+	_, d := openTestDB(t)
+	sch := new(schema.Schema)
+	sch.Put("veg", newMemTable("name"))
+	d.Catalog.Put("db2", sch)
+	driverutil.DefaultRegistry.RegisterDb(t.Name(), d)
+
+	db, err := sql.Open("dbutils", t.Name()+"?readonly=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := queryRows(t, db, "select name from fruit where qty > 4"); !reflect.DeepEqual(got, []string{"banana", "cherry"}) {
+		t.Errorf("got %v", got)
+	}
+	if _, err := db.Exec("delete from fruit"); err != driverutil.ErrReadOnly {
+		t.Errorf("delete on a read-only connection: %v", err)
+	}
+	db2, err := sql.Open("dbutils", t.Name()+"?schema=db2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	if _, err := db2.Exec("insert into veg values ('leek')"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db2, "select name from veg"); !reflect.DeepEqual(got, []string{"leek"}) {
+		t.Errorf("schema db2: %v", got)
+	}
+	for _, dsn := range []string{"nosuch", t.Name() + "?schema=nosuch"} {
+		if _, err := sql.Open("dbutils", dsn); err == nil {
+			t.Errorf("%s: no error", dsn)
+		}
+	}
+
+	opened := 0
+	driverutil.RegisterOpener("testmem", func(path string) (*driverutil.Database, error) {
+		opened++
+		nd := new(driverutil.Database)
+		nd.Sch.Put(path, newMemTable("name"))
+		return nd, nil
+	})
+	for i := 0; i < 2; i++ {
+		db, err := sql.Open("dbutils", "testmem:basket")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := queryRows(t, db, "select name from basket"); len(got) != 0 {
+			t.Errorf("opened database: %v", got)
+		}
+		db.Close()
+	}
+	if opened != 1 {
+		t.Errorf("opened %d times", opened)
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/mad-day/db-utils/table/util"
+)
+
+var explainColumns = []string{"table","step","detail","mode"}
+
+/*
+Strips a leading EXPLAIN keyword off the query. The parser accepts EXPLAIN,
+but discards the statement.
+*/
+func explainPrefix(query string) (string,bool) {
+	q := strings.TrimLeftFunc(query,unicode.IsSpace)
+	if len(q)<8 || !strings.EqualFold(q[:7],"explain") || !unicode.IsSpace(rune(q[7])) { return query,false }
+	return q[8:],true
+}
+
+// Iterates over a fixed set of rows.
+type rowsIterator struct {
+	rows [][]interface{}
+}
+func (r *rowsIterator) Close() error { return nil }
+func (r *rowsIterator) Next(cols []int,vals []interface{}) error {
+	if len(r.rows)==0 { return io.EOF }
+	for i,j := range cols { vals[i] = r.rows[0][j] }
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type explainScanner struct {
+	rows [][]interface{}
+}
+func (e *explainScanner) lng() int { return len(explainColumns) }
+func (e *explainScanner) scan(ctx context.Context) (*tableResultSet,error) {
+	n := len(explainColumns)
+	types := make([]table.ColumnType,n)
+	for i := range types { types[i] = util.VT_STRING.ColumnType(false) }
+	return &tableResultSet{explainColumns,&rowsIterator{e.rows},identity(n),make([]interface{},n),types,nil},nil
+}
+
+/*
+Describes a compiled statement, one row per step: The tables, the result
+columns, every filter and ordering, and whether it is pushed down onto the
+table or evaluated over the scanned rows ("residual", "sort"), and the
+access path, the table chooses.
+*/
+type explainer struct {
+	sch  *schema.Schema
+	rows [][]interface{}
+}
+func (e *explainer) add(tab,step,detail,mode string) {
+	e.rows = append(e.rows,[]interface{}{tab,step,detail,mode})
+}
+
+// Returns the name of the table within the schema.
+func (e *explainer) name(tab table.Table) string {
+	if n,ok := e.sch.NameOf(tab); ok { return n }
+	return fmt.Sprintf("%T",tab)
+}
+func valueString(v interface{}) string {
+	switch vv := v.(type) {
+	case string: return fmt.Sprintf("%q",vv)
+	case []byte: return fmt.Sprintf("x'%x'",vv)
+	case []interface{}:
+		s := make([]string,len(vv))
+		for i,x := range vv { s[i] = valueString(x) }
+		return "("+strings.Join(s,", ")+")"
+	}
+	return fmt.Sprint(v)
+}
+func columnName(cols []string,i int) string {
+	if i>=0 && i<len(cols) { return cols[i] }
+	return fmt.Sprintf("$%d",i)
+}
+func filterString(cols []string,f *table.ColumnFilter) string {
+	s := columnName(cols,f.Index)+" "+f.Operator
+	switch f.Operator {
+	case "is null","is not null": return s
+	}
+	s += " "+valueString(f.Value)
+	if f.Escape!=nil { s += " escape "+valueString(f.Escape) }
+	return s
+}
+
+// Describes a table scan, that is split as by util.SplitScan.
+func (e *explainer) scan(name string,tab table.Table,scan *table.TableScan) {
+	cols := tab.Columns()
+	pushed,residual,where := util.SplitScan(tab,scan)
+	for i := range pushed.Filter { e.add(name,"filter",filterString(cols,&pushed.Filter[i]),"pushed") }
+	for i := range residual { e.add(name,"filter",filterString(cols,&residual[i]),"residual") }
+	if scan.Where!=nil {
+		mode := "pushed"
+		if where!=nil { mode = "residual" }
+		e.add(name,"where",scan.Where.String(),mode)
+	}
+	ordered := orderPushable(tab,scan)
+	for _,o := range scan.Order {
+		mode := "pushed"
+		if !ordered { mode = "sort" }
+		e.add(name,"order",columnName(cols,o.Index)+" "+o.Operator(),mode)
+	}
+	if scan.HasLimit() {
+		mode := "pushed"
+		if len(residual)!=0 || where!=nil || !ordered { mode = "residual" }
+		e.add(name,"limit",fmt.Sprintf("limit %s offset %s",valueString(scan.Limit),valueString(scan.Offset)),mode)
+	}
+	path := "unknown"
+	if et,ok := tab.(table.ExplainingTable); ok { path = et.ExplainScan(&pushed) }
+	e.add(name,"access",path,"")
+}
+
+func (e *explainer) query(q *schema.Query) {
+	name := e.name(q.Table)
+	cols := q.Table.Columns()
+	e.add(name,"table",name,"")
+	
+	// The names of the input row, see schema.Query.
+	var input []string
+	for _,c := range q.Cols { input = append(input,name+"."+columnName(cols,c)) }
+	e.scan(name,q.Table,q.Scan)
+	for _,j := range q.Joins {
+		jn := e.name(j.Table)
+		jc := j.Table.Columns()
+		for _,c := range j.Cols { input = append(input,jn+"."+columnName(jc,c)) }
+		kind := "inner join"
+		if j.Left { kind = "left join" }
+		method := "hash join"
+		if lookupJoin(j) { method = "index nested loop" }
+		e.add(jn,"join",kind+" "+jn,method)
+		for i := range j.OuterKeys {
+			e.add(jn,"join key",columnName(input,j.OuterKeys[i])+" = "+jn+"."+columnName(jc,j.InnerKeys[i]),method)
+		}
+		if j.On!=nil { e.add(jn,"on",j.On.String(),"residual") }
+		e.scan(jn,j.Table,j.Scan)
+	}
+	if q.Where!=nil { e.add("","where",q.Where.String(),"residual") }
+	for _,o := range q.Order { e.add("","order",columnName(input,o.Index)+" "+o.Operator(),"sort") }
+	
+	exprs := q.Exprs
+	if agg := q.Agg; agg!=nil {
+		var inter []string
+		for _,g := range agg.GroupBy {
+			inter = append(inter,columnName(input,g))
+			e.add("","group by",columnName(input,g),"")
+		}
+		for _,a := range agg.Aggs {
+			arg := "*"
+			if a.Arg>=0 { arg = columnName(input,a.Arg) }
+			if a.Distinct { arg = "distinct "+arg }
+			s := fmt.Sprintf("%s(%s)",a.Func,arg)
+			inter = append(inter,s)
+			e.add("","aggregate",s,"")
+		}
+		if agg.Having!=nil { e.add("","having",agg.Having.String(),"residual") }
+		if agg.OrderResult { inter = q.Names }
+		for _,o := range agg.Order { e.add("","order",columnName(inter,o.Index)+" "+o.Operator(),"sort") }
+		exprs = agg.Exprs
+	}
+	for i,n := range q.Names {
+		if exprs!=nil {
+			e.add("","column",exprs[i].String()+" as "+n,"computed")
+			continue
+		}
+		e.add("","column",n,"")
+	}
+}
+
+func (e *explainer) plan(p *plan) {
+	switch {
+	case p.query!=nil: e.query(p.query)
+	case p.ins!=nil,p.insSel!=nil:
+		tab,job := p.tab,p.ins
+		if p.insSel!=nil { tab,job = p.insSel.Table,p.insSel.Job }
+		name := e.name(tab)
+		cols := tab.Columns()
+		op := map[table.TableOp]string{table.T_Insert:"insert",table.T_InsertIgnore:"insert ignore",table.T_Replace:"replace"}[job.Op]
+		e.add(name,"table",name,"")
+		if p.insSel!=nil {
+			e.add(name,op,"from select","streamed")
+			e.query(p.insSel.Source)
+		} else {
+			e.add(name,op,fmt.Sprintf("%d rows",len(job.Values)),"")
+		}
+		for i,c := range job.OndupCols {
+			e.add(name,"on duplicate key update",columnName(cols,c)+" = "+valueString(job.OndupVals[i]),"")
+		}
+	case p.upd!=nil:
+		name := e.name(p.tab)
+		cols := p.tab.Columns()
+		e.add(name,"table",name,"")
+		if p.upd.Op==table.T_Delete {
+			e.add(name,"delete","","")
+		}
+		for i,c := range p.upd.UpdCols {
+			e.add(name,"update",columnName(cols,c)+" = "+valueString(p.upd.UpdVals[i]),"")
+		}
+		e.scan(name,p.tab,p.upd.Scan)
+	case p.ddl!=nil:
+		e.add(p.ddl.Name,"ddl",p.ddl.Action+" "+p.ddl.Name,"")
+	case p.use!=nil:
+		e.add("","use",p.use.Name,"")
+	}
+}
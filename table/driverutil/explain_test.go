@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mad-day/db-utils/table/schema"
+)
+
+func TestExplain(t *testing.T) {
+	db, _ := openTestDB(t)
+	explain := func(db *sql.DB, query string) map[string]string {
+		t.Helper()
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		steps := make(map[string]string)
+		for rows.Next() {
+			var tab, step, detail, mode string
+			if err := rows.Scan(&tab, &step, &detail, &mode); err != nil {
+				t.Fatal(err)
+			}
+			steps[step+": "+detail] = mode
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return steps
+	}
+	steps := explain(db, "EXPLAIN select name from fruit where qty > 3 order by name")
+	for step, mode := range map[string]string{
+		"table: fruit":    "",
+		"column: name":    "",
+		"filter: qty > 3": "pushed",
+		"access: unknown": "",
+	} {
+		if m, ok := steps[step]; !ok || m != mode {
+			t.Errorf("%q: got %q (present %v), want %q; all: %v", step, m, ok, mode, steps)
+		}
+	}
+	steps = explain(db, "explain update fruit set qty = 0 where name = 'apple'")
+	if m, ok := steps[`filter: name = "apple"`]; !ok || m != "pushed" {
+		t.Errorf("update: %v", steps)
+	}
+	if _, err := db.Exec("explain delete from fruit"); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow("select count(*) from fruit").Scan(&n); err != nil || n != 3 {
+		t.Errorf("count: %d, %v", n, err)
+	}
+
+	// Updates and deletes evaluate the filters, the table rejects, themselves.
+	kdb, d := openKeyDB(t)
+	d.Catalog.Put("db2", new(schema.Schema))
+	for query, want := range map[string]map[string]string{
+		"explain update fruit set qty = 0 where name = 'apple' and qty > 1": {
+			`filter: name = "apple"`: "pushed",
+			"filter: qty > 1":        "residual",
+		},
+		"explain delete from fruit where qty > 1 or name = 'kiwi'": {
+			`where: or[{$1 > 1} {$0 = "kiwi"}]`: "residual",
+		},
+		"explain use db2": {"use: db2": ""},
+	} {
+		steps := explain(kdb, query)
+		for step, mode := range want {
+			if m, ok := steps[step]; !ok || m != mode {
+				t.Errorf("%s: %q: got %q (present %v), want %q; all: %v", query, step, m, ok, mode, steps)
+			}
+		}
+	}
+}
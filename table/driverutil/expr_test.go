@@ -0,0 +1,62 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Expressions in the select list, in WHERE and in SET.
+func TestExpressions(t *testing.T) {
+	db, _ := openTestDB(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select name, qty * 2 + 1 as x from fruit where name = 'apple'", []string{"apple|7"}},
+		{"select qty / 0, qty div 2, -qty, qty % 2, null + 1 from fruit where name = 'banana'",
+			[]string{"NULL|2|-5|1|NULL"}},
+		{"select name from fruit where qty * 2 > 10", []string{"cherry"}},
+		{"select name from fruit where qty + 1 = 4 or name = concat('ch', 'erry')", []string{"apple", "cherry"}},
+		{"select case when qty > 4 then 'many' else 'few' end from fruit", []string{"few", "many", "many"}},
+	} {
+		if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+	rows, err := db.Query("select qty * 2, name as n from fruit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, _ := rows.Columns()
+	rows.Close()
+	if !reflect.DeepEqual(cols, []string{"qty * 2", "n"}) {
+		t.Errorf("columns: %v", cols)
+	}
+	if _, err := db.Exec("update fruit set qty = qty * 10 - ? where qty > 4", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select qty from fruit"); !reflect.DeepEqual(got, []string{"3", "49", "69"}) {
+		t.Errorf("after update: %v", got)
+	}
+}
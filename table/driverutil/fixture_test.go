@@ -0,0 +1,504 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/driverutil"
+	"github.com/mad-day/db-utils/table/util"
+)
+
+// An in-memory table, keyed by its first column.
+type memTable struct {
+	mu   *sync.Mutex
+	cols []string
+	base *[][]interface{}
+	rows *[][]interface{}
+
+	// If not nil, the int64 key is generated from this sequence.
+	seq *int64
+}
+
+func (t *memTable) AutoIncrementColumn() int {
+	if t.seq != nil {
+		return 0
+	}
+	return -1
+}
+
+func newMemTable(cols ...string) *memTable {
+	rows := new([][]interface{})
+	return &memTable{mu: new(sync.Mutex), cols: cols, base: rows, rows: rows}
+}
+
+func (t *memTable) Columns() []string    { return t.cols }
+func (t *memTable) ScanPredicates() bool { return true }
+func (t *memTable) ScanCaps() []table.ColumnCaps {
+	caps := make([]table.ColumnCaps, len(t.cols))
+	for i := range caps {
+		caps[i].Operators = []string{"=", "<=>", "<", "<=", ">", ">=", "!=", "in", "not in", "like", "not like", "is null", "is not null"}
+	}
+	return caps
+}
+
+// Returns the indices of the rows selected by the scan.
+func (t *memTable) match(meta *table.TableScan) ([]int, error) {
+	if len(meta.Order) != 0 {
+		return nil, meta.Order[0].Err(table.E_ORDERBY_ORDER, t.cols)
+	}
+	limit, offset, err := meta.LimitOffset()
+	if err != nil {
+		return nil, err
+	}
+	all := make([]int, len(t.cols))
+	for i := range all {
+		all[i] = i
+	}
+	var m util.Matcher
+	var sel []int
+	for i, row := range *t.rows {
+		ok, err := m.MatchAll(meta.Filter, all, row)
+		if err == nil && ok {
+			ok, err = m.MatchPredicate(meta.Where, all, row)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit == 0 {
+			break
+		}
+		limit--
+		sel = append(sel, i)
+	}
+	return sel, nil
+}
+
+// Unlike keyIter, it applies the limit of the scan.
+type memIter struct{ keyIter }
+
+func (it *memIter) LimitApplied() bool { return true }
+
+func (t *memTable) TableScan(cols []int, meta *table.TableScan) (table.TableIterator, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sel, err := t.match(meta)
+	if err != nil {
+		return nil, err
+	}
+	it := new(memIter)
+	for _, i := range sel {
+		it.rows = append(it.rows, append([]interface{}(nil), (*t.rows)[i]...))
+	}
+	return it, nil
+}
+
+type memStmt struct{ t *memTable }
+
+func (s memStmt) Close() error { return nil }
+func (s memStmt) Abort() error { return nil }
+
+func (t *memTable) TablePrepareInsert(ti *table.TableInsert) (table.TableInsertStmt, error) {
+	return memStmt{t}, nil
+}
+func (s memStmt) TableInsert(ti *table.TableInsert) (*table.ModifyResult, error) {
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var m util.Matcher
+	var cnt int64
+	var lastId *int64
+	for _, vals := range ti.Values {
+		row := make([]interface{}, len(t.cols))
+		for i, v := range vals {
+			if e, ok := v.(*table.Expression); ok {
+				r, err := m.Eval(e, nil, nil)
+				if err != nil {
+					return nil, err
+				}
+				v = r
+			}
+			j := i
+			if !ti.AllCols {
+				j = ti.Cols[i]
+			}
+			row[j] = v
+		}
+		if t.seq != nil && (row[0] == nil || row[0] == int64(0)) {
+			*t.seq++
+			id := *t.seq
+			row[0] = id
+			if lastId == nil {
+				lastId = &id
+			}
+		}
+		dup := -1
+		for i, r := range *t.rows {
+			if c, err := util.Compare(r[0], row[0]); err == nil && c == 0 {
+				dup = i
+			}
+		}
+		switch {
+		case dup < 0:
+			*t.rows = append(*t.rows, row)
+			cnt++
+		case ti.Op == table.T_Replace:
+			(*t.rows)[dup] = row
+			cnt += 2
+		case ti.Op == table.T_InsertIgnore:
+		case len(ti.OndupCols) != 0:
+			old := (*t.rows)[dup]
+			upd := make([]interface{}, len(ti.OndupCols))
+			if err := m.OndupValues(ti, old, row, upd); err != nil {
+				return nil, err
+			}
+			for i, c := range ti.OndupCols {
+				old[c] = upd[i]
+			}
+			cnt += 2
+		default:
+			return nil, fmt.Errorf("duplicate key %v", row[0])
+		}
+	}
+	return &table.ModifyResult{lastId, &cnt}, nil
+}
+
+func (t *memTable) TablePrepareUpdate(tu *table.TableUpdate) (table.TableUpdateStmt, error) {
+	return memStmt{t}, nil
+}
+func (s memStmt) TableUpdate(tu *table.TableUpdate) (*table.ModifyResult, error) {
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sel, err := t.match(tu.Scan)
+	if err != nil {
+		return nil, err
+	}
+	cnt := int64(len(sel))
+	if tu.Op == table.T_Delete {
+		del := make(map[int]bool)
+		for _, i := range sel {
+			del[i] = true
+		}
+		rest := (*t.rows)[:0]
+		for i, r := range *t.rows {
+			if !del[i] {
+				rest = append(rest, r)
+			}
+		}
+		*t.rows = rest
+		return &table.ModifyResult{nil, &cnt}, nil
+	}
+	var m util.Matcher
+	all := make([]int, len(t.cols))
+	for i := range all {
+		all[i] = i
+	}
+	dst := make([]interface{}, len(tu.UpdCols))
+	for _, i := range sel {
+		row := (*t.rows)[i]
+		if err := m.UpdateValues(tu, all, row, dst); err != nil {
+			return nil, err
+		}
+		for k, c := range tu.UpdCols {
+			row[c] = dst[k]
+		}
+	}
+	return &table.ModifyResult{nil, &cnt}, nil
+}
+
+// A transaction works on a copy of the rows, that replaces them on commit.
+type memTx struct {
+	t    *memTable
+	rows [][]interface{}
+}
+
+func (tx *memTx) Commit() error {
+	tx.t.mu.Lock()
+	defer tx.t.mu.Unlock()
+	*tx.t.base = tx.rows
+	return nil
+}
+func (tx *memTx) Rollback() error { return nil }
+
+func (t *memTable) TxResource() interface{} { return t.base }
+func (t *memTable) TxBegin(writable bool) (table.Tx, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx := &memTx{t: t}
+	for _, r := range *t.base {
+		tx.rows = append(tx.rows, append([]interface{}(nil), r...))
+	}
+	return tx, nil
+}
+func (t *memTable) WithTx(tx table.Tx) (table.Table, error) {
+	mtx, ok := tx.(*memTx)
+	if !ok {
+		return nil, fmt.Errorf("foreign transaction %T", tx)
+	}
+	return &memTable{mu: t.mu, cols: t.cols, base: t.base, rows: &mtx.rows, seq: t.seq}, nil
+}
+
+// A restricted table: It filters its first column by "=" and nothing else,
+// and applies neither ordering nor limits to its scans.
+type keyTable struct {
+	mu   *sync.Mutex
+	cols []string
+	rows *[][]interface{}
+}
+
+func newKeyTable(cols ...string) *keyTable {
+	return &keyTable{mu: new(sync.Mutex), cols: cols, rows: new([][]interface{})}
+}
+
+func (t *keyTable) Columns() []string { return t.cols }
+func (t *keyTable) ScanCaps() []table.ColumnCaps {
+	caps := make([]table.ColumnCaps, len(t.cols))
+	caps[0].Operators = []string{"="}
+	return caps
+}
+
+// Returns the indices of the rows selected by the filters of the scan.
+func (t *keyTable) match(meta *table.TableScan) ([]int, error) {
+	if meta.Where != nil {
+		return nil, table.ErrPredicateUnsupp
+	}
+	if len(meta.Order) != 0 {
+		return nil, meta.Order[0].Err(table.E_ORDERBY_FIELD, t.cols)
+	}
+	for i := range meta.Filter {
+		f := &meta.Filter[i]
+		if f.Index != 0 {
+			return nil, f.Err(table.E_FILTER_FIELD_UNSUPP, t.cols)
+		}
+		if f.Operator != "=" {
+			return nil, f.Err(table.E_FILTER_OPERATOR_UNSUPP, t.cols)
+		}
+	}
+	var sel []int
+rows:
+	for i, row := range *t.rows {
+		for _, f := range meta.Filter {
+			if c, err := util.Compare(row[0], f.Value); f.Value == nil || err != nil || c != 0 {
+				continue rows
+			}
+		}
+		sel = append(sel, i)
+	}
+	return sel, nil
+}
+
+type keyIter struct {
+	rows [][]interface{}
+}
+
+func (it *keyIter) Close() error { return nil }
+func (it *keyIter) Next(cols []int, vals []interface{}) error {
+	if len(it.rows) == 0 {
+		return io.EOF
+	}
+	for i, c := range cols {
+		vals[i] = it.rows[0][c]
+	}
+	it.rows = it.rows[1:]
+	return nil
+}
+
+func (t *keyTable) TableScan(cols []int, meta *table.TableScan) (table.TableIterator, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sel, err := t.match(meta)
+	if err != nil {
+		return nil, err
+	}
+	it := new(keyIter)
+	for _, i := range sel {
+		it.rows = append(it.rows, append([]interface{}(nil), (*t.rows)[i]...))
+	}
+	return it, nil
+}
+
+type keyStmt struct{ t *keyTable }
+
+func (s keyStmt) Close() error { return nil }
+func (s keyStmt) Abort() error { return nil }
+
+// Applies the limit of the scan, as UpdateableTable requires.
+func (t *keyTable) TablePrepareUpdate(tu *table.TableUpdate) (table.TableUpdateStmt, error) {
+	return keyStmt{t}, nil
+}
+func (s keyStmt) TableUpdate(tu *table.TableUpdate) (*table.ModifyResult, error) {
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sel, err := t.match(tu.Scan)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := tu.Scan.LimitOffset()
+	if err != nil {
+		return nil, err
+	}
+	if offset > int64(len(sel)) {
+		offset = int64(len(sel))
+	}
+	sel = sel[offset:]
+	if limit >= 0 && limit < int64(len(sel)) {
+		sel = sel[:limit]
+	}
+	cnt := int64(len(sel))
+	var m util.Matcher
+	all := make([]int, len(t.cols))
+	for i := range all {
+		all[i] = i
+	}
+	dst := make([]interface{}, len(tu.UpdCols))
+	del := make(map[int]bool)
+	for _, i := range sel {
+		row := (*t.rows)[i]
+		if tu.Op == table.T_Delete {
+			del[i] = true
+			continue
+		}
+		if err := m.UpdateValues(tu, all, row, dst); err != nil {
+			return nil, err
+		}
+		for k, c := range tu.UpdCols {
+			row[c] = dst[k]
+		}
+	}
+	rest := (*t.rows)[:0]
+	for i, r := range *t.rows {
+		if !del[i] {
+			rest = append(rest, r)
+		}
+	}
+	*t.rows = rest
+	return &table.ModifyResult{nil, &cnt}, nil
+}
+
+// Opens d through a registry of its own.
+func openDB(t *testing.T, d *driverutil.Database) *sql.DB {
+	reg := new(driverutil.DbRegistry)
+	reg.RegisterDb(t.Name(), d)
+	c, err := reg.OpenConnector(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func openTestDB(t *testing.T) (*sql.DB, *driverutil.Database) {
+	d := new(driverutil.Database)
+	tab := newMemTable("name", "qty")
+	*tab.rows = [][]interface{}{
+		{"apple", int64(3)},
+		{"banana", int64(5)},
+		{"cherry", int64(7)},
+	}
+	d.Sch.Put("fruit", tab)
+	return openDB(t, d), d
+}
+
+// Opens a database, whose tables are keyTables: fruit(name, qty), color(fruit, color)
+// and stock(id, fruit, qty).
+func openKeyDB(t *testing.T) (*sql.DB, *driverutil.Database) {
+	d := new(driverutil.Database)
+	for name, tab := range map[string]struct {
+		cols []string
+		rows [][]interface{}
+	}{
+		"fruit": {[]string{"name", "qty"}, [][]interface{}{
+			{"apple", int64(3)}, {"banana", int64(5)}, {"cherry", int64(7)},
+		}},
+		"color": {[]string{"fruit", "color"}, [][]interface{}{
+			{"apple", "red"}, {"banana", "yellow"}, {"kiwi", "green"},
+		}},
+		"stock": {[]string{"id", "fruit", "qty"}, [][]interface{}{
+			{int64(1), "apple", int64(10)}, {int64(2), "cherry", int64(1)}, {int64(3), "apple", int64(2)},
+		}},
+	} {
+		kt := newKeyTable(tab.cols...)
+		*kt.rows = tab.rows
+		d.Sch.Put(name, kt)
+	}
+	return openDB(t, d), d
+}
+
+// Returns the rows of the query, with the columns of each row joined by "|".
+func queryRows(t *testing.T, q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) []string {
+	t.Helper()
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		dst := make([]interface{}, len(cols))
+		for i := range dst {
+			dst[i] = &vals[i]
+		}
+		if err := rows.Scan(dst...); err != nil {
+			t.Fatal(err)
+		}
+		strs := make([]string, len(vals))
+		for i, v := range vals {
+			switch x := v.(type) {
+			case nil:
+				strs[i] = "NULL"
+			case []byte:
+				strs[i] = string(x)
+			default:
+				strs[i] = fmt.Sprint(x)
+			}
+		}
+		res = append(res, strings.Join(strs, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	db, _ := openTestDB(t)
+	for expr, want := range map[string]string{
+		"concat(lower('AB'), upper(name))":                           "abAPPLE",
+		"concat_ws('-', name, null, qty)":                            "apple-3",
+		"ifnull(null, qty)":                                          "3",
+		"if(qty > 2, 'many', 'few')":                                 "many",
+		"substring(name, 2, 3)":                                      "ppl",
+		"substr(name from -2 for 2)":                                 "le",
+		"length(repeat(name, 2))":                                    "10",
+		"lpad(qty, 3, '0')":                                          "003",
+		"replace(name, 'p', 'P')":                                    "aPPle",
+		"locate('p', name, 3)":                                       "3",
+		"round(2.567, 2)":                                            "2.57",
+		"mod(qty, 2) + abs(-4) + floor(1.5)":                         "6",
+		"greatest(qty, 2, 9)":                                        "9",
+		"date_format('2019-01-02 03:04:05', '%Y/%m/%d %H:%i %a %M')": "2019/01/02 03:04 Wed January",
+		"unix_timestamp('1970-01-02 00:00:00')":                      "86400",
+		"from_unixtime(86400, '%Y-%m-%d')":                           "1970-01-02",
+		"datediff('2019-03-01', '2019-02-01') + year('2019-05-06')":  "2047",
+		"isnull(nullif(qty, 3))":                                     "1",
+		"year(now()) >= 2019 and unix_timestamp() > 1500000000":      "true",
+		"coalesce(null, null, name)":                                 "apple",
+		"if(null, 'yes', 'no')":                                      "no",
+		"isnull(concat(name, null))":                                 "1",
+		"rpad(name, 8, 'xy')":                                        "applexyx",
+		"lpad('é', 3, 'ñ')":                                          "ññé",
+		"length(space(3))":                                           "3",
+		// Results longer than max_allowed_packet are NULL.
+		"isnull(repeat(name, 1000000000000))":                          "1",
+		"isnull(space(9000000000000000000))":                           "1",
+		"isnull(lpad(name, 100000000, 'x'))":                           "1",
+		"isnull(replace(repeat('a', 1000000), 'a', repeat('b', 100)))": "1",
+	} {
+		var got string
+		if err := db.QueryRow("select " + expr + " from fruit where name = 'apple'").Scan(&got); err != nil {
+			t.Errorf("%s: %v", expr, err)
+		} else if got != want {
+			t.Errorf("%s: got %q, want %q", expr, got, want)
+		}
+	}
+	if _, err := db.Exec("insert into fruit values (concat('ki', 'wi'), unix_timestamp())"); err != nil {
+		t.Fatal(err)
+	}
+	var qty int64
+	if err := db.QueryRow("select qty from fruit where name = 'kiwi'").Scan(&qty); err != nil {
+		t.Fatal(err)
+	} else if qty < 1500000000 {
+		t.Errorf("unix_timestamp(): %d", qty)
+	}
+	for query, msg := range map[string]string{
+		"select nosuch(name) from fruit":     "unknown function: nosuch",
+		"select lower(name, 1) from fruit":   "wrong number of arguments to lower: 2",
+		"select upper() from fruit":          "wrong number of arguments to upper: 0",
+		"insert into fruit values (name, 1)": "column not found: name",
+	} {
+		_, err := db.Exec(query)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: got %v, want %q", query, err, msg)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"database/sql/driver"
+	"github.com/mad-day/db-utils/table"
+	"io"
+)
+
+// The empty result set of a statement, that returns no rows.
+type noRows struct{}
+func (noRows) Columns() []string { return nil }
+func (noRows) Close() error { return nil }
+func (noRows) Next(dest []driver.Value) error { return io.EOF }
+
+// Applies TableScan.Limit and TableScan.Offset onto an iterator, that didn't.
+type limitIterator struct {
+	table.TableIterator
+	limit,offset int64
+}
+func (l *limitIterator) Next(cols []int,vals []interface{}) error {
+	for ; l.offset>0 ; l.offset-- {
+		if err := l.TableIterator.Next(cols,vals); err!=nil { return err }
+	}
+	if l.limit==0 { return io.EOF }
+	if l.limit>0 { l.limit-- }
+	return l.TableIterator.Next(cols,vals)
+}
+
+func limitApplied(iter table.TableIterator) bool {
+	li,ok := iter.(table.LimitingIterator)
+	return ok && li.LimitApplied()
+}
+
+// Wraps 'iter' into a limitIterator, unless it has applied the limit itself.
+func enforceLimit(iter table.TableIterator,scan *table.TableScan) (table.TableIterator,error) {
+	if !scan.HasLimit() || limitApplied(iter) { return iter,nil }
+	limit,offset,err := scan.LimitOffset()
+	if err!=nil {
+		iter.Close()
+		return nil,err
+	}
+	return &limitIterator{iter,limit,offset},nil
+}
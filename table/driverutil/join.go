@@ -0,0 +1,266 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/mad-day/db-utils/table/util"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func identity(n int) []int {
+	cols := make([]int,n)
+	for i := range cols { cols[i] = i }
+	return cols
+}
+
+/*
+Normalizes a join key, so that equal values of different types hash alike.
+Numeric strings hash as numbers, as util.Compare() compares them to numbers
+that way. The candidates of a hash bucket are compared by util.Compare().
+*/
+func hashValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int64: return float64(n)
+	case string: return hashText(n)
+	case []byte: return hashText(string(n))
+	case bool:
+		if n { return float64(1) }
+		return float64(0)
+	}
+	return v
+}
+func hashText(s string) interface{} {
+	if f,err := strconv.ParseFloat(strings.TrimSpace(s),64); err==nil { return f }
+	return s
+}
+
+/*
+Reports, whether the inner table of 'j' can serve an equality filter on one
+of the join keys. Such joins are executed as index-nested-loop joins,
+everything else as hash join.
+*/
+func lookupJoin(j *schema.Join) bool {
+	st,ok := j.Table.(table.ScanCapableTable)
+	if !ok { return false }
+	caps := st.ScanCaps()
+	for _,k := range j.InnerKeys {
+		if k<len(caps) && caps[k].HasOperator("=") { return true }
+	}
+	return false
+}
+
+// Joins the rows of a table to the rows of 'src'. See schema.Join.
+type joinIterator struct {
+	ctx   context.Context
+	src   table.TableIterator
+	j     *schema.Join
+	outer []int
+	all   []int
+	row   []interface{}
+	m     util.Matcher
+	buf   bytes.Buffer
+
+	lookup  bool
+	loaded  bool
+	hash    map[string][][]interface{}
+
+	have    bool
+	matched bool
+	inner   table.TableIterator
+	rows    [][]interface{}
+}
+func newJoinIterator(ctx context.Context,src table.TableIterator,width int,j *schema.Join) *joinIterator {
+	return &joinIterator{
+		ctx:ctx,
+		src:src,
+		j:j,
+		outer:identity(width),
+		all:identity(width+len(j.Cols)),
+		row:make([]interface{},width+len(j.Cols)),
+		lookup:lookupJoin(j),
+	}
+}
+
+// Looks up the inner rows, which are candidates for the current input row.
+func (ji *joinIterator) open() error {
+	j := ji.j
+	for _,k := range j.OuterKeys {
+		if ji.row[k]==nil { return nil } // NULL never equals anything.
+	}
+	if ji.lookup {
+		scan := *j.Scan
+		scan.Filter = append([]table.ColumnFilter(nil),j.Scan.Filter...)
+		for i,k := range j.InnerKeys {
+			scan.Filter = append(scan.Filter,table.ColumnFilter{Index:k,Operator:"=",Value:ji.row[j.OuterKeys[i]]})
+		}
+		ti,err := util.ResidualScanContext(ji.ctx,j.Table,j.Cols,&scan)
+		if err!=nil { return err }
+		ji.inner = ti
+		return nil
+	}
+	if !ji.loaded {
+		ji.loaded = true
+		if err := ji.load(); err!=nil { return err }
+	}
+	key := make([]interface{},len(j.OuterKeys))
+	for i,k := range j.OuterKeys { key[i] = hashValue(ji.row[k]) }
+	k,err := encodeKey(&ji.buf,key...)
+	if err!=nil { return err }
+	ji.rows = ji.hash[k]
+	return nil
+}
+
+// Builds the hash table of the inner table.
+func (ji *joinIterator) load() error {
+	j := ji.j
+	ti,err := util.ResidualScanContext(ji.ctx,j.Table,j.Cols,j.Scan)
+	if err!=nil { return err }
+	defer ti.Close()
+	ji.hash = make(map[string][][]interface{})
+	key := make([]interface{},len(j.InnerKeys))
+	outer:
+	for {
+		vals := make([]interface{},len(j.Cols))
+		err := ti.Next(j.Cols,vals)
+		if err==io.EOF { break }
+		if err!=nil { return err }
+		for i,k := range j.InnerKeys {
+			v := vals[indexOf(j.Cols,k)]
+			if v==nil { continue outer }
+			key[i] = hashValue(v)
+		}
+		hk,err := encodeKey(&ji.buf,key...)
+		if err!=nil { return err }
+		ji.hash[hk] = append(ji.hash[hk],vals)
+	}
+	return nil
+}
+
+// Fetches the next candidate into the inner part of the row.
+func (ji *joinIterator) nextInner() error {
+	w := len(ji.outer)
+	if ji.inner!=nil { return ji.inner.Next(ji.j.Cols,ji.row[w:]) }
+	for len(ji.rows)!=0 {
+		vals := ji.rows[0]
+		ji.rows = ji.rows[1:]
+		copy(ji.row[w:],vals)
+		// Hash keys are normalized, so compare the actual values.
+		ok := true
+		for i,k := range ji.j.InnerKeys {
+			c,err := util.Compare(ji.row[ji.j.OuterKeys[i]],vals[indexOf(ji.j.Cols,k)])
+			if err!=nil || c!=0 { ok = false; break }
+		}
+		if ok { return nil }
+	}
+	return io.EOF
+}
+func (ji *joinIterator) closeInner() (err error) {
+	if ji.inner!=nil { err = ji.inner.Close() }
+	ji.inner,ji.rows = nil,nil
+	return
+}
+func (ji *joinIterator) emit(cols []int,vals []interface{}) {
+	for i,c := range cols { vals[i] = ji.row[c] }
+}
+func (ji *joinIterator) Next(cols []int,vals []interface{}) error {
+	w := len(ji.outer)
+	for {
+		if !ji.have {
+			if err := ji.src.Next(ji.outer,ji.row[:w]); err!=nil { return err }
+			ji.have,ji.matched = true,false
+			if err := ji.open(); err!=nil { return err }
+		}
+		err := ji.nextInner()
+		if err==io.EOF {
+			ji.have = false
+			if err = ji.closeInner(); err!=nil { return err }
+			if ji.j.Left && !ji.matched {
+				for i := w; i<len(ji.row); i++ { ji.row[i] = nil }
+				ji.emit(cols,vals)
+				return nil
+			}
+			continue
+		}
+		if err!=nil { return err }
+		ok,err := ji.m.MatchPredicate(ji.j.On,ji.all,ji.row)
+		if err!=nil { return err }
+		if ok {
+			ji.matched = true
+			ji.emit(cols,vals)
+			return nil
+		}
+	}
+}
+func (ji *joinIterator) Close() error {
+	err := ji.src.Close()
+	if e := ji.closeInner(); err==nil { err = e }
+	ji.hash = nil
+	return err
+}
+
+// Filters the rows of the underlying iterator by a predicate.
+type filterIterator struct {
+	src  table.TableIterator
+	cols []int
+	row  []interface{}
+	p    *table.Predicate
+	m    util.Matcher
+}
+func (f *filterIterator) Next(cols []int,vals []interface{}) error {
+	for {
+		if err := f.src.Next(f.cols,f.row); err!=nil { return err }
+		ok,err := f.m.MatchPredicate(f.p,f.cols,f.row)
+		if err!=nil { return err }
+		if ok { break }
+	}
+	for i,c := range cols { vals[i] = f.row[c] }
+	return nil
+}
+func (f *filterIterator) Close() error { return f.src.Close() }
+
+/*
+Scans the first table and joins the other tables. The columns of the
+resulting rows are 0..width-1 (see schema.Query).
+*/
+func (db *Database) joinScan(ctx context.Context,q *schema.Query) (ti table.TableIterator,width int,err error) {
+	scan := *q.Scan
+	scan.Limit,scan.Offset = nil,nil
+	ti,err = util.ResidualScanContext(ctx,q.Table,q.Cols,&scan)
+	if err!=nil { return }
+	width = len(q.Cols)
+	for _,j := range q.Joins {
+		ti = newJoinIterator(ctx,ti,width,j)
+		width += len(j.Cols)
+	}
+	if q.Where!=nil {
+		ti = &filterIterator{src:ti,cols:identity(width),row:make([]interface{},width),p:q.Where}
+	}
+	return
+}
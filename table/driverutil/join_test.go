@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Joins over keyTables: A join on the key of the inner table looks its rows
+// up, any other join builds a hash table.
+func TestJoin(t *testing.T) {
+	db, d := openKeyDB(t)
+	mem := newMemTable("name", "origin")
+	*mem.rows = [][]interface{}{{"apple", "north"}, {"cherry", "south"}}
+	d.Sch.Put("origin", mem)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		// Lookup join on color.fruit.
+		{"select f.name, c.color from fruit f join color c on c.fruit = f.name order by f.name",
+			[]string{"apple|red", "banana|yellow"}},
+		{"select f.name, c.color from fruit f left join color c on c.fruit = f.name order by f.name",
+			[]string{"apple|red", "banana|yellow", "cherry|NULL"}},
+		// Hash join on stock.fruit, which is not the key.
+		{"select s.id, f.name, s.qty from fruit f join stock s on s.fruit = f.name order by s.id",
+			[]string{"1|apple|10", "2|cherry|1", "3|apple|2"}},
+		{"select f.name, s.id from fruit f left join stock s on s.fruit = f.name and s.qty > 5 order by f.name",
+			[]string{"apple|1", "banana|NULL", "cherry|NULL"}},
+		// A residual filter on the inner table and the WHERE clause over the joined rows.
+		{"select s.id from stock s join fruit f on f.name = s.fruit where f.qty > 4 or s.qty = 2 order by s.id",
+			[]string{"2", "3"}},
+		// Three tables, one of them a memTable.
+		{"select f.name, c.color, o.origin from fruit f join color c on c.fruit = f.name join origin o on o.name = f.name order by f.name",
+			[]string{"apple|red|north"}},
+		// Without ordering, the joined rows are projected directly.
+		{"select f.name, c.color from fruit f join color c on c.fruit = f.name",
+			[]string{"apple|red", "banana|yellow"}},
+		{"select c.color, o.origin from fruit f join origin o on o.name = f.name join color c on c.fruit = f.name",
+			[]string{"red|north"}},
+		{"select s.qty, f.name from fruit f join stock s on s.fruit = f.name where s.qty < 5",
+			[]string{"2|apple", "1|cherry"}},
+		{"select f.name from fruit f join stock s on s.fruit = f.name order by s.qty desc limit 1 offset 1",
+			[]string{"apple"}},
+	} {
+		if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+
+	// Both strategies match numbers with numeric strings.
+	label := newKeyTable("code", "num")
+	*label.rows = [][]interface{}{{"1", "1"}, {"3", " 3"}, {"x", "x"}}
+	d.Sch.Put("label", label)
+	for query, method := range map[string]string{
+		"select s.id from stock s join label l on l.code = s.id order by s.id": "index nested loop",
+		"select s.id from stock s join label l on l.num = s.id order by s.id":  "hash join",
+	} {
+		var tab, step, detail, mode string
+		rows, err := db.Query("explain " + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for rows.Next() {
+			if err := rows.Scan(&tab, &step, &detail, &mode); err != nil {
+				t.Fatal(err)
+			}
+			if step == "join" && mode == method {
+				found = true
+			}
+		}
+		rows.Close()
+		if !found {
+			t.Errorf("%s: not a %s", query, method)
+		}
+		if got := queryRows(t, db, query); !reflect.DeepEqual(got, []string{"1", "3"}) {
+			t.Errorf("%s: got %v", query, got)
+		}
+	}
+}
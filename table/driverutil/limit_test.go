@@ -0,0 +1,53 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// A memTable applies limits itself, a keyTable leaves them to the driver.
+func TestLimit(t *testing.T) {
+	mdb, _ := openTestDB(t)
+	kdb, _ := openKeyDB(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select name from fruit limit 2", []string{"apple", "banana"}},
+		{"select name from fruit limit 1 offset 1", []string{"banana"}},
+		{"select name from fruit limit 5 offset 3", nil},
+		{"select name from fruit where qty > 2 limit 1 offset 2", []string{"cherry"}},
+		{"select name from fruit where name = 'apple' limit 0", nil},
+		{"select name from fruit order by qty desc limit 2", []string{"cherry", "banana"}},
+		{"select name from fruit order by name desc limit 1 offset 1", []string{"banana"}},
+	} {
+		for _, db := range []*sql.DB{mdb, kdb} {
+			if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestInsertSelect(t *testing.T) {
+	db, d := openTestDB(t)
+	d.Sch.Put("archive", newMemTable("name", "qty"))
+	d.InsertBatchSize = 2
+	res, err := db.Exec("insert into archive select name, qty * 2 from fruit where qty > ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 3 {
+		t.Errorf("RowsAffected: %d, %v", n, err)
+	}
+	if got := queryRows(t, db, "select name from archive where qty = 14"); !reflect.DeepEqual(got, []string{"cherry"}) {
+		t.Errorf("got %v", got)
+	}
+	if _, err := db.Exec("insert into archive (name) select name from fruit"); err == nil {
+		t.Error("insert of duplicate keys succeeded")
+	}
+	if _, err := db.Exec("insert into archive select name from fruit"); err == nil {
+		t.Error("insert with a column count mismatch succeeded")
+	}
+	if _, err := db.Exec("insert into fruit select concat(name, '2'), qty from fruit"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select name from fruit"); len(got) != 6 {
+		t.Errorf("self-referencing insert: %v", got)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	db, _ := openTestDB(t)
+	stmt, err := db.Prepare("insert into fruit values (?, ?) on duplicate key update qty = qty + values(qty)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	for _, c := range []struct {
+		name     string
+		qty      int
+		affected int64
+		want     int64
+	}{{"apple", 10, 2, 13}, {"durian", 4, 1, 4}, {"durian", 1, 2, 5}} {
+		res, err := stmt.Exec(c.name, c.qty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n != c.affected {
+			t.Errorf("%s: %d rows affected, %v", c.name, n, err)
+		}
+		var qty int64
+		if err := db.QueryRow("select qty from fruit where name = ?", c.name).Scan(&qty); err != nil || qty != c.want {
+			t.Errorf("%s: got %d, %v", c.name, qty, err)
+		}
+	}
+	if _, err := db.Exec("insert into fruit values ('apple', 1) on duplicate key update qty = ?", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select name from fruit where qty = 0"); !reflect.DeepEqual(got, []string{"apple"}) {
+		t.Errorf("got %v", got)
+	}
+	if _, err := db.Exec("update fruit set qty = values(qty)"); err == nil {
+		t.Error("values() outside of on duplicate key update succeeded")
+	}
+}
+
+func TestLastInsertId(t *testing.T) {
+	db, d := openTestDB(t)
+	tab := newMemTable("id", "name")
+	tab.seq = new(int64)
+	d.Sch.Put("basket", tab)
+	lastId := func(res sql.Result, err error) int64 {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	if id := lastId(db.Exec("insert into basket (name) values (?)", "apple")); id != 1 {
+		t.Errorf("single row: %d", id)
+	}
+	if id := lastId(db.Exec("insert into basket (name) values ('banana'), ('cherry')")); id != 2 {
+		t.Errorf("multiple rows: %d", id)
+	}
+	if id := lastId(db.Exec("insert into basket (name) select name from fruit")); id != 4 {
+		t.Errorf("insert ... select: %d", id)
+	}
+	var n int64
+	if err := db.QueryRow("select count(*) from basket").Scan(&n); err != nil || n != 6 {
+		t.Errorf("count: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"database/sql/driver"
+	"github.com/mad-day/db-utils/table/schema"
+	"fmt"
+	"reflect"
+)
+
+/*
+Returns the placeholder name of an argument. Unnamed arguments are positional
+and bind to the "?" placeholders, which the parser names :v1, :v2, ...
+*/
+func argName(nv *driver.NamedValue) string {
+	if nv.Name=="" { return fmt.Sprintf("v%d",nv.Ordinal) }
+	return nv.Name
+}
+
+/*
+Converts an argument. A slice (other than []byte) is accepted for list
+placeholders, and converted element-wise into []interface{}.
+*/
+func checkNamedValue(sm schema.SetterMap,nv *driver.NamedValue) error {
+	nv.Name = argName(nv)
+	if s := sm[nv.Name]; s!=nil && s.ListArg {
+		rv := reflect.ValueOf(nv.Value)
+		if rv.Kind()==reflect.Slice && rv.Type().Elem().Kind()!=reflect.Uint8 {
+			l := make([]interface{},rv.Len())
+			for i := range l {
+				v,err := driver.DefaultParameterConverter.ConvertValue(rv.Index(i).Interface())
+				if err!=nil { return fmt.Errorf("parameter :%s: %v",nv.Name,err) }
+				l[i] = v
+			}
+			nv.Value = l
+			return nil
+		}
+	}
+	val,err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err!=nil { return err }
+	nv.Value = val
+	return nil
+}
+
+/*
+Binds the arguments to the placeholders, converted into the types of their
+columns. Every placeholder needs exactly one argument.
+*/
+func bindArgs(sm schema.SetterMap,args []driver.NamedValue) error {
+	sm.Reset()
+	for i := range args {
+		arg := &args[i]
+		name := argName(arg)
+		s := sm[name]
+		if s==nil { return fmt.Errorf("extra argument: no placeholder :%s",name) }
+		if s.IsSet() { return fmt.Errorf("placeholder :%s bound twice",name) }
+		if s.Mixed { return fmt.Errorf("placeholder :%s used as list and as value",name) }
+		if l,ok := arg.Value.([]interface{}); ok && s.ListArg {
+			vals := make([]interface{},len(l))
+			for j,v := range l {
+				var err error
+				if vals[j],err = s.Coerce(v); err!=nil { return fmt.Errorf("placeholder :%s: %v",name,err) }
+			}
+			s.PutList(vals)
+			continue
+		}
+		v,err := s.Coerce(arg.Value)
+		if err!=nil { return fmt.Errorf("placeholder :%s: %v",name,err) }
+		s.Put(v)
+	}
+	for _,p := range sm.Params() {
+		if !sm[p.Name].IsSet() { return fmt.Errorf("missing argument for placeholder :%s",p.Name) }
+	}
+	return nil
+}
+
+// Converts the arguments of the legacy driver.Stmt methods, which are positional.
+func namedValues(sm schema.SetterMap,args []driver.Value) ([]driver.NamedValue,error) {
+	nvs := make([]driver.NamedValue,len(args))
+	for i,v := range args {
+		nvs[i] = driver.NamedValue{Ordinal:i+1,Value:v}
+		if err := checkNamedValue(sm,&nvs[i]); err!=nil { return nil,err }
+	}
+	return nvs,nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/util"
+)
+
+func TestCoercion(t *testing.T) {
+	db, d := openTestDB(t)
+	d.Sch.Put("people", typedMemTable{newMemTable("name", "age"), []table.ColumnType{
+		util.VT_STRING.ColumnType(false),
+		util.VT_INT.ColumnType(true),
+	}})
+	if _, err := db.Exec("insert into people values (?, ?)", "ann", "42"); err != nil {
+		t.Fatal(err)
+	}
+	var age interface{}
+	if err := db.QueryRow("select age from people where age = ?", " 42 ").Scan(&age); err != nil {
+		t.Fatal(err)
+	}
+	if age != int64(42) {
+		t.Errorf("age: %#v", age)
+	}
+	if got := queryRows(t, db, "select name from people where age in ::ages and name like :n", sql.Named("ages", []string{"41", "42"}), sql.Named("n", "a%")); len(got) != 1 {
+		t.Errorf("in list: %v", got)
+	}
+	for query, args := range map[string][]interface{}{
+		"insert into people values (?, ?)":               {"bob", "abc"},
+		"insert into people (age, name) values (:a, :n)": {sql.Named("a", "abc"), sql.Named("n", "bob")},
+		"update people set age = ? where name = ?":       {"abc", "ann"},
+	} {
+		_, err := db.Exec(query, args...)
+		if want := "cannot convert 'abc' to BIGINT for column age"; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %q", query, err, want)
+		}
+	}
+	// Values, that are only compared with a column, are not converted, unless that is lossless.
+	for query, args := range map[string][]interface{}{
+		"select name from people where age > 1.5":  nil,
+		"select name from people where age > ?":    {1.5},
+		"select name from people where age < ?":    {42.5},
+		"select name from people where age = ?":    {42.0},
+		"select name from people where age in ::a": {sql.Named("a", []interface{}{41.5, "42"})},
+	} {
+		if got := queryRows(t, db, query, args...); len(got) != 1 {
+			t.Errorf("%s %v: %v", query, args, got)
+		}
+	}
+	if _, err := db.Exec("update people set age = ? where name = ?", nil, "ann"); err != nil {
+		t.Errorf("NULL: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// Prepared statements know their placeholders.
+func TestNumInput(t *testing.T) {
+	_, d := openTestDB(t)
+	conn := d.NewConn()
+	defer conn.Close()
+	for query, n := range map[string]int{
+		"select name from fruit":                                       0,
+		"select name from fruit where qty > ? and name != ?":           2,
+		"select name from fruit where qty = :q or qty = :q + 1":        1,
+		"select name from fruit where name in ::names limit ?":         2,
+		"insert into fruit values (?, ?), (?, :qty)":                   4,
+		"update fruit set qty = ? where name = ? order by qty limit ?": 3,
+	} {
+		stmt, err := conn.Prepare(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got := stmt.NumInput(); got != n {
+			t.Errorf("%s: NumInput %d, want %d", query, got, n)
+		}
+		stmt.Close()
+	}
+}
+
+// Missing, extra and misnamed arguments are rejected.
+func TestArguments(t *testing.T) {
+	db, _ := openTestDB(t)
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"select name from fruit where qty = ?", nil},
+		{"select name from fruit where qty = ?", []interface{}{1, 2}},
+		{"select name from fruit where qty = :q", []interface{}{sql.Named("x", 1)}},
+		{"select name from fruit where qty = :q", []interface{}{sql.Named("q", 1), sql.Named("q", 2)}},
+		{"select name from fruit where qty = ? or name in ::n", []interface{}{3}},
+	} {
+		if _, err := db.Query(c.query, c.args...); err == nil {
+			t.Errorf("%s %v: no error", c.query, c.args)
+		}
+	}
+}
+
+// "?", ":name" and sql.Named arguments bind alike.
+func TestPlaceholders(t *testing.T) {
+	db, _ := openTestDB(t)
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"select name from fruit where qty > ? and name != ?", []interface{}{4, "banana"}},
+		{"select name from fruit where qty > :q and name != :n", []interface{}{sql.Named("q", 4), sql.Named("n", "banana")}},
+		{"select name from fruit where name != :n and qty > :q", []interface{}{sql.Named("q", 4), sql.Named("n", "banana")}},
+		{"select name from fruit where qty > :q and name in ::n", []interface{}{sql.Named("q", 4), sql.Named("n", []string{"cherry"})}},
+	} {
+		if got := queryRows(t, db, c.query, c.args...); !reflect.DeepEqual(got, []string{"cherry"}) {
+			t.Errorf("%s: got %v", c.query, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// Opens a database with a memTable, which evaluates predicate trees itself, and one
+// with a keyTable, for which the driver does. Both have the row ('kiwi', NULL) added.
+func openPredicateDBs(t *testing.T) []*sql.DB {
+	mdb, md := openTestDB(t)
+	kdb, kd := openKeyDB(t)
+	mt := md.Sch.Get("fruit").(*memTable)
+	*mt.rows = append(*mt.rows, []interface{}{"kiwi", nil})
+	kt := kd.Sch.Get("fruit").(*keyTable)
+	*kt.rows = append(*kt.rows, []interface{}{"kiwi", nil})
+	return []*sql.DB{mdb, kdb}
+}
+
+func TestPredicates(t *testing.T) {
+	dbs := openPredicateDBs(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select name from fruit where name = 'apple' or qty = 7", []string{"apple", "cherry"}},
+		{"select name from fruit where not (qty < 7)", []string{"cherry"}},
+		{"select name from fruit where name in ('apple', 'cherry')", []string{"apple", "cherry"}},
+		{"select name from fruit where name not in ('apple', 'cherry')", []string{"banana", "kiwi"}},
+		{"select name from fruit where name like 'b%' or qty is null", []string{"banana", "kiwi"}},
+		{"select name from fruit where qty is not null and name not like '%an%'", []string{"apple", "cherry"}},
+		{"select name from fruit where qty between 4 and 8 and name != 'cherry'", []string{"banana"}},
+		{"select name from fruit where not (name = 'apple' or qty > 4)", nil},
+	} {
+		for i, db := range dbs {
+			if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s (%d): got %v, want %v", c.query, i, got, c.want)
+			}
+		}
+	}
+	for _, c := range []struct {
+		stmt string
+		want []string
+	}{
+		{"delete from fruit where name = 'apple' or qty = 7", []string{"banana|5", "kiwi|NULL"}},
+		{"delete from fruit where not (qty < 5)", []string{"apple|3", "kiwi|NULL"}},
+		{"update fruit set qty = 0 where qty is null or name in ('apple')", []string{"apple|0", "banana|5", "cherry|7", "kiwi|0"}},
+	} {
+		t.Run("", func(t *testing.T) {
+			for i, db := range openPredicateDBs(t) {
+				if _, err := db.Exec(c.stmt); err != nil {
+					t.Fatalf("%s (%d): %v", c.stmt, i, err)
+				}
+				if got := queryRows(t, db, "select name, qty from fruit"); !reflect.DeepEqual(got, c.want) {
+					t.Errorf("%s (%d): got %v, want %v", c.stmt, i, got, c.want)
+				}
+			}
+		})
+	}
+}
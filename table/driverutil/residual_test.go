@@ -0,0 +1,76 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+Scans of a keyTable: Filters it rejects are evaluated over the rows, and the
+limit and ordering, it can't serve, are applied afterwards.
+*/
+func TestResidualScan(t *testing.T) {
+	db, _ := openKeyDB(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select name from fruit where name = 'banana'", []string{"banana"}},
+		{"select name from fruit where qty > 4", []string{"banana", "cherry"}},
+		{"select name from fruit where name = 'banana' and qty = 5", []string{"banana"}},
+		{"select name from fruit where name = 'banana' and qty = 3", nil},
+	} {
+		if got := queryRows(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+// Updates and deletes on a keyTable, with filters it can't evaluate itself.
+func TestResidualUpdate(t *testing.T) {
+	for _, c := range []struct {
+		stmt     string
+		affected int64
+		want     []string
+	}{
+		{"update fruit set qty = 0 where qty > 4", 2, []string{"apple|3", "banana|0", "cherry|0"}},
+		{"update fruit set qty = qty + 1 where name = 'banana' and qty = 5", 1, []string{"apple|3", "banana|6", "cherry|7"}},
+		{"update fruit set qty = qty + 1 where qty > 2 order by qty desc limit 1", 1, []string{"apple|3", "banana|5", "cherry|8"}},
+		{"update fruit set qty = 1 where name = 'kiwi'", 0, []string{"apple|3", "banana|5", "cherry|7"}},
+	} {
+		t.Run("", func(t *testing.T) {
+			db, _ := openKeyDB(t)
+			res, err := db.Exec(c.stmt)
+			if err != nil {
+				t.Fatalf("%s: %v", c.stmt, err)
+			}
+			if n, err := res.RowsAffected(); err != nil || n != c.affected {
+				t.Errorf("%s: %d rows affected, %v", c.stmt, n, err)
+			}
+			if got := queryRows(t, db, "select name, qty from fruit"); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s: got %v, want %v", c.stmt, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mad-day/db-utils/table/schema"
+)
+
+func TestSchemas(t *testing.T) {
+	db, d := openTestDB(t)
+	for name, users := range map[string][]interface{}{
+		"db1": {"ann", "bob"},
+		"db2": {"bob", "cid"},
+	} {
+		sch := new(schema.Schema)
+		tab := newMemTable("id", "name")
+		for i, u := range users {
+			*tab.rows = append(*tab.rows, []interface{}{int64(i + 1), u})
+		}
+		sch.Put("users", tab)
+		d.Catalog.Put(name, sch)
+	}
+	exec := func(e interface {
+		Exec(string, ...interface{}) (sql.Result, error)
+	}, query string) {
+		t.Helper()
+		if _, err := e.Exec(query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	check := func(q interface {
+		Query(string, ...interface{}) (*sql.Rows, error)
+	}, query, want string) {
+		t.Helper()
+		if got := strings.Join(queryRows(t, q, query), ","); got != want {
+			t.Errorf("%s: got %q, want %q", query, got, want)
+		}
+	}
+	check(db, "select name from db1.users", "ann,bob")
+	check(db, "select name from DB2.users", "bob,cid")
+	check(db, "select db1.users.name from db1.users join db2.users on db1.users.name = db2.users.name", "bob")
+	if _, err := db.Query("select users.name from db1.users join db2.users on db1.users.id = db2.users.id"); err == nil {
+		t.Error("ambiguous table name accepted")
+	}
+	if _, err := db.Query("select name from db3.users"); err == nil {
+		t.Error("unknown schema accepted")
+	}
+
+	exec(db, "insert into db2.users values (3, 'dan')")
+	exec(db, "update db1.users set name = 'amy' where id = 1")
+	exec(db, "delete from db2.users where name = 'bob'")
+	check(db, "select name from db1.users", "amy,bob")
+	check(db, "select name from db2.users", "cid,dan")
+	check(db, "show tables from db1", "users")
+	check(db, "select table_schema from information_schema.tables where table_name = 'users'", "db1,db2")
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.QueryContext(ctx, "select name from users"); err == nil {
+		t.Error("users found in the default schema")
+	}
+	for _, c := range []struct{ use, want string }{{"db1", "amy,bob"}, {"db2", "cid,dan"}} {
+		if _, err := conn.ExecContext(ctx, "use "+c.use); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := conn.QueryContext(ctx, "select name from users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for rows.Next() {
+			var n string
+			rows.Scan(&n)
+			names = append(names, n)
+		}
+		rows.Close()
+		if got := strings.Join(names, ","); got != c.want {
+			t.Errorf("use %s: got %q, want %q", c.use, got, c.want)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "use missing"); err == nil {
+		t.Error("use of an unknown schema")
+	}
+	check(db, "select name from fruit where qty < 5", "apple")
+}
+
+func TestQualifiers(t *testing.T) {
+	db, _ := openTestDB(t)
+	for query, want := range map[string]string{
+		"select fruit.name from fruit where fruit.qty > 3":                   "banana,cherry",
+		"select f.name from fruit as f where f.qty < 5 order by f.name":      "apple",
+		"select f.* from fruit f where f.name = 'cherry'":                    "cherry",
+		"select f.name from fruit f group by f.name having count(f.qty) > 5": "",
+	} {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		var names []string
+		for rows.Next() {
+			cols, _ := rows.Columns()
+			vals := make([]interface{}, len(cols))
+			dst := make([]interface{}, len(cols))
+			for i := range dst {
+				dst[i] = &vals[i]
+			}
+			if err := rows.Scan(dst...); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, fmt.Sprint(vals[0]))
+		}
+		rows.Close()
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("%s: got %q, want %q", query, got, want)
+		}
+	}
+	for query, msg := range map[string]string{
+		"select x.name from fruit as y":                                              "unknown table: x",
+		"select fruit.name from fruit as f":                                          "unknown table: fruit",
+		"select wrong.qty from fruit":                                                "unknown table: wrong",
+		"select z.* from fruit":                                                      "unknown table: z",
+		"select name from fruit where other.qty > 1":                                 "unknown table: other",
+		"select name from fruit order by other.name":                                 "unknown table: other",
+		"update fruit set other.qty = 1":                                             "unknown table: other",
+		"delete from fruit where other.name = 'apple'":                               "unknown table: other",
+		"insert into fruit values ('kiwi', 1) on duplicate key update other.qty = 2": "unknown table: other",
+	} {
+		_, err := db.Exec(query)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: got %v, want %q", query, err, msg)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/xwb1989/sqlparser"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const identRe = "`(?:[^`]|``)*`|[\\w$]+"
+
+var (
+	showTablesRe = regexp.MustCompile(`(?is)^\s*show\s+(full\s+)?tables(?:\s+(?:from|in)\s+(`+identRe+`))?(\s.*)?$`)
+	showColumnsRe = regexp.MustCompile(`(?is)^\s*show\s+(?:full\s+)?(?:columns|fields)\s+(?:from|in)\s+(`+identRe+`)(?:\.(`+identRe+`))?(?:\s+(?:from|in)\s+(`+identRe+`))?(\s.*)?$`)
+)
+
+func unquoteIdent(s string) string {
+	if strings.HasPrefix(s,"`") { s = strings.Replace(s[1:len(s)-1],"``","`",-1) }
+	return strings.ToLower(s)
+}
+func strLiteral(s string) string { return sqlparser.String(sqlparser.NewStrVal([]byte(s))) }
+
+/*
+A SHOW TABLES or SHOW COLUMNS statement, rewritten into a SELECT over the
+catalog tables (see schema.InformationSchema). The parser discards most of
+these statements, so they are matched textually.
+*/
+type showStmt struct {
+	query string
+	
+	// The schema of the statement, and the table of SHOW COLUMNS.
+	schema,table string
+	
+	// Maps the lower case result column names to the catalog columns, for
+	// the WHERE clause.
+	renames map[string]string
+}
+
+/*
+Returns nil, if 'query' is no SHOW TABLES or SHOW COLUMNS statement. Unless
+the statement names a schema, it refers to the schema 'def'.
+*/
+func parseShow(query,def string) (*showStmt,error) {
+	s := showStmt{schema:def}
+	var sel,cond,nameCol,rest string
+	if m := showTablesRe.FindStringSubmatch(query); m!=nil {
+		sel = "select table_name as `Tables`"
+		s.renames = map[string]string{"tables":"table_name"}
+		if m[1]!="" {
+			sel += ", table_type as `Table_type`"
+			s.renames["table_type"] = "table_type"
+		}
+		sel += " from "+schema.InformationSchema+".tables"
+		if m[2]!="" { s.schema = unquoteIdent(m[2]) }
+		nameCol,rest = "table_name",m[3]
+	} else if m := showColumnsRe.FindStringSubmatch(query); m!=nil {
+		s.table = unquoteIdent(m[1])
+		if m[2]!="" { s.schema,s.table = s.table,unquoteIdent(m[2]) }
+		if m[3]!="" { s.schema = unquoteIdent(m[3]) }
+		sel = "select column_name as `Field`, data_type as `Type`, is_nullable as `Null`, extra as `Extra` from "+schema.InformationSchema+".columns"
+		cond = "table_name = "+strLiteral(s.table)
+		s.renames = map[string]string{"field":"column_name","type":"data_type","null":"is_nullable","extra":"extra"}
+		nameCol,rest = "column_name",m[4]
+	} else {
+		return nil,nil
+	}
+	
+	cond = andCond("table_schema = "+strLiteral(s.schema),cond)
+	rest = strings.TrimSpace(rest)
+	switch lr := strings.ToLower(rest); {
+	case rest=="":
+	case strings.HasPrefix(lr,"like") && len(rest)>4 && isSpace(rest[4]):
+		cond = andCond(cond,nameCol+" "+rest)
+	case strings.HasPrefix(lr,"where") && len(rest)>5 && isSpace(rest[5]):
+		cond = andCond(cond,"("+rest[6:]+")")
+	default: return nil,fmt.Errorf("syntax error at: %s",rest)
+	}
+	s.query = sel+" where "+cond
+	return &s,nil
+}
+func isSpace(b byte) bool { return b==' ' || b=='\t' || b=='\n' || b=='\r' }
+func andCond(a,b string) string {
+	switch {
+	case a=="": return b
+	case b=="": return a
+	}
+	return a+" and "+b
+}
+
+// Renames the references to result columns in the WHERE clause of 'stmt'.
+func (s *showStmt) rename(stmt sqlparser.Statement) {
+	sel,ok := stmt.(*sqlparser.Select)
+	if !ok || sel.Where==nil { return }
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool,error) {
+		if c,ok := node.(*sqlparser.ColName); ok && c.Qualifier.IsEmpty() {
+			if n,ok := s.renames[c.Name.Lowered()]; ok { c.Name = sqlparser.NewColIdent(n) }
+		}
+		return true,nil
+	},sel.Where)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	db, d := openTestDB(t)
+	d.Sch.Put("archive", newMemTable("name", "qty"))
+	firstColumn := func(query string) (names []string) {
+		t.Helper()
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		defer rows.Close()
+		cols, _ := rows.Columns()
+		vals := make([]interface{}, len(cols))
+		for i := range vals {
+			vals[i] = new(interface{})
+		}
+		for rows.Next() {
+			if err := rows.Scan(vals...); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, fmt.Sprint(*vals[0].(*interface{})))
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	for query, want := range map[string]string{
+		"select table_name from information_schema.tables":                              "archive,fruit",
+		"select column_name from information_schema.columns where table_name = 'fruit'": "name,qty",
+		"select column_name from information_schema.columns where ordinal_position = 2": "qty,qty",
+		"SHOW TABLES":                                  "archive,fruit",
+		"show tables like 'f%'":                        "fruit",
+		"show tables where `Tables` = 'archive'":       "archive",
+		"show columns from fruit":                      "name,qty",
+		"SHOW FIELDS IN `fruit` LIKE 'q%'":             "qty",
+		"show columns from fruit where Field <> 'qty'": "name",
+	} {
+		if got := strings.Join(firstColumn(query), ","); got != want {
+			t.Errorf("%s: got %q, want %q", query, got, want)
+		}
+	}
+	for query, want := range map[string]string{
+		"show full tables":        "Tables,Table_type",
+		"show columns from fruit": "Field,Type,Null,Extra",
+	} {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cols, _ := rows.Columns()
+		rows.Close()
+		if got := strings.Join(cols, ","); got != want {
+			t.Errorf("%s: columns %s, want %s", query, got, want)
+		}
+	}
+	if _, err := db.Query("show columns from missing"); err == nil {
+		t.Error("show columns of a missing table")
+	}
+	if _, err := db.Exec("delete from information_schema.tables"); err == nil {
+		t.Error("catalog tables must be read-only")
+	}
+}
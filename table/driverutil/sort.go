@@ -0,0 +1,340 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/util"
+	"container/heap"
+	"encoding/binary"
+	"bufio"
+	"math"
+	"time"
+	"sort"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The default memory budget of a sort operation, see Database.SortBudget.
+const DefaultSortBudget = 64<<20
+
+// Compares two rows by the given ordering. NULL is the smallest value.
+type rowOrder struct {
+	pos  []int
+	desc []bool
+	err  error
+}
+func (o *rowOrder) compare(a,b []interface{}) int {
+	for i,p := range o.pos {
+		x,y := a[p],b[p]
+		var c int
+		switch {
+		case x==nil && y==nil: c = 0
+		case x==nil: c = -1
+		case y==nil: c = 1
+		default:
+			var err error
+			c,err = util.Compare(x,y)
+			if err!=nil && o.err==nil { o.err = err }
+		}
+		if o.desc[i] { c = -c }
+		if c!=0 { return c }
+	}
+	return 0
+}
+
+// Estimates the memory footprint of a row.
+func rowSize(row []interface{}) int64 {
+	n := int64(24+16*len(row))
+	for _,v := range row {
+		switch vv := v.(type) {
+		case string: n += int64(len(vv))
+		case []byte: n += int64(len(vv))
+		case time.Time: n += 24
+		}
+	}
+	return n
+}
+
+const (
+	tagNull byte = iota
+	tagInt
+	tagFloat
+	tagFalse
+	tagTrue
+	tagBytes
+	tagString
+	tagTime
+)
+
+type rowWriter interface {
+	io.Writer
+	io.ByteWriter
+}
+
+func writeRow(w rowWriter,row []interface{}) error {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:],uint64(len(row)))])
+	for _,v := range row {
+		var data []byte
+		switch vv := v.(type) {
+		case nil: w.WriteByte(tagNull); continue
+		case int64:
+			w.WriteByte(tagInt)
+			w.Write(buf[:binary.PutVarint(buf[:],vv)])
+			continue
+		case float64:
+			w.WriteByte(tagFloat)
+			binary.BigEndian.PutUint64(buf[:],math.Float64bits(vv))
+			w.Write(buf[:8])
+			continue
+		case bool:
+			if vv { w.WriteByte(tagTrue) } else { w.WriteByte(tagFalse) }
+			continue
+		case []byte: w.WriteByte(tagBytes); data = vv
+		case string: w.WriteByte(tagString); data = []byte(vv)
+		case time.Time:
+			var err error
+			data,err = vv.MarshalBinary()
+			if err!=nil { return err }
+			w.WriteByte(tagTime)
+		default: return fmt.Errorf("sort: cannot spill %T",v)
+		}
+		w.Write(buf[:binary.PutUvarint(buf[:],uint64(len(data)))])
+		w.Write(data)
+	}
+	return nil
+}
+func readRow(r *bufio.Reader) ([]interface{},error) {
+	n,err := binary.ReadUvarint(r)
+	if err!=nil { return nil,err }
+	row := make([]interface{},n)
+	for i := range row {
+		tag,err := r.ReadByte()
+		if err!=nil { return nil,noEOF(err) }
+		switch tag {
+		case tagNull: continue
+		case tagInt:
+			row[i],err = binary.ReadVarint(r)
+		case tagFloat:
+			var b [8]byte
+			_,err = io.ReadFull(r,b[:])
+			row[i] = math.Float64frombits(binary.BigEndian.Uint64(b[:]))
+		case tagFalse,tagTrue: row[i] = tag==tagTrue
+		case tagBytes,tagString,tagTime:
+			var l uint64
+			l,err = binary.ReadUvarint(r)
+			if err!=nil { break }
+			data := make([]byte,l)
+			_,err = io.ReadFull(r,data)
+			if err!=nil { break }
+			switch tag {
+			case tagBytes: row[i] = data
+			case tagString: row[i] = string(data)
+			case tagTime:
+				var t time.Time
+				err = t.UnmarshalBinary(data)
+				row[i] = t
+			}
+		default: err = fmt.Errorf("sort: corrupted run file")
+		}
+		if err!=nil { return nil,noEOF(err) }
+	}
+	return row,nil
+}
+func noEOF(err error) error {
+	if err==io.EOF { return io.ErrUnexpectedEOF }
+	return err
+}
+
+// A sorted run, spilled to disk.
+type sortRun struct {
+	f   *os.File
+	r   *bufio.Reader
+	row []interface{}
+}
+func (s *sortRun) advance() (err error) {
+	s.row,err = readRow(s.r)
+	return
+}
+
+// A min-heap of sorted runs, ordered by their current row.
+type runHeap struct {
+	runs []*sortRun
+	o *rowOrder
+}
+func (h *runHeap) Len() int { return len(h.runs) }
+func (h *runHeap) Less(i, j int) bool { return h.o.compare(h.runs[i].row,h.runs[j].row)<0 }
+func (h *runHeap) Swap(i, j int) { h.runs[i],h.runs[j] = h.runs[j],h.runs[i] }
+func (h *runHeap) Push(x interface{}) { h.runs = append(h.runs,x.(*sortRun)) }
+func (h *runHeap) Pop() interface{} {
+	n := len(h.runs)-1
+	r := h.runs[n]
+	h.runs = h.runs[:n]
+	return r
+}
+
+/*
+Sorts the rows of an iterator. Rows are sorted in memory, as long as their
+estimated size is within the budget. Beyond that, sorted runs are spilled
+into temporary files and merged (external merge sort).
+*/
+type sortIterator struct {
+	src    table.TableIterator
+	cols   []int
+	o      rowOrder
+	budget int64
+	dir    string
+
+	sorted bool
+	mem    [][]interface{}
+	files  []*os.File
+	h      runHeap
+}
+func newSortIterator(src table.TableIterator,cols []int,order []table.ColumnOrder,budget int64,dir string) *sortIterator {
+	s := &sortIterator{src:src,cols:cols,budget:budget,dir:dir}
+	if s.budget<=0 { s.budget = DefaultSortBudget }
+	for _,o := range order {
+		s.o.pos = append(s.o.pos,indexOf(cols,o.Index))
+		s.o.desc = append(s.o.desc,o.Desc)
+	}
+	return s
+}
+func indexOf(cols []int,i int) int {
+	for p,j := range cols { if i==j { return p } }
+	return -1
+}
+func (s *sortIterator) sortMem() error {
+	sort.SliceStable(s.mem,func(i, j int) bool { return s.o.compare(s.mem[i],s.mem[j])<0 })
+	return s.o.err
+}
+func (s *sortIterator) spill() error {
+	if err := s.sortMem(); err!=nil { return err }
+	f,err := os.CreateTemp(s.dir,"dbutils-sort-*")
+	if err!=nil { return err }
+	s.files = append(s.files,f)
+	w := bufio.NewWriter(f)
+	for _,row := range s.mem {
+		if err = writeRow(w,row); err!=nil { return err }
+	}
+	if err = w.Flush(); err!=nil { return err }
+	s.mem = s.mem[:0]
+	return nil
+}
+func (s *sortIterator) load() error {
+	defer func() { s.src.Close(); s.src = nil }()
+	var size int64
+	for {
+		row := make([]interface{},len(s.cols))
+		err := s.src.Next(s.cols,row)
+		if err==io.EOF { break }
+		if err!=nil { return err }
+		s.mem = append(s.mem,row)
+		size += rowSize(row)
+		if size>s.budget {
+			if err = s.spill(); err!=nil { return err }
+			size = 0
+		}
+	}
+	if len(s.files)==0 { return s.sortMem() }
+	if len(s.mem)!=0 {
+		if err := s.spill(); err!=nil { return err }
+	}
+	s.h.o = &s.o
+	for _,f := range s.files {
+		if _,err := f.Seek(0,io.SeekStart); err!=nil { return err }
+		run := &sortRun{f:f,r:bufio.NewReader(f)}
+		err := run.advance()
+		if err==io.EOF { continue }
+		if err!=nil { return err }
+		s.h.runs = append(s.h.runs,run)
+	}
+	heap.Init(&s.h)
+	return s.o.err
+}
+func (s *sortIterator) next() ([]interface{},error) {
+	if len(s.files)==0 {
+		if len(s.mem)==0 { return nil,io.EOF }
+		row := s.mem[0]
+		s.mem = s.mem[1:]
+		return row,nil
+	}
+	if s.h.Len()==0 { return nil,io.EOF }
+	run := s.h.runs[0]
+	row := run.row
+	if err := run.advance(); err==io.EOF {
+		heap.Pop(&s.h)
+	} else if err!=nil {
+		return nil,err
+	} else {
+		heap.Fix(&s.h,0)
+	}
+	return row,s.o.err
+}
+func (s *sortIterator) Next(cols []int,vals []interface{}) error {
+	if !s.sorted {
+		s.sorted = true
+		if err := s.load(); err!=nil { return err }
+	}
+	row,err := s.next()
+	if err!=nil { return err }
+	copy(vals,row)
+	return nil
+}
+func (s *sortIterator) Close() (err error) {
+	if s.src!=nil { err = s.src.Close() }
+	for _,f := range s.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.files = nil
+	s.mem = nil
+	return
+}
+
+// Returns true, if every order of the scan can be pushed down, as far as known up front.
+func orderPushable(tab table.Table,scan *table.TableScan) bool {
+	ctab,ok := tab.(table.ScanCapableTable)
+	if !ok { return true }
+	caps := ctab.ScanCaps()
+	for i := range scan.Order {
+		o := &scan.Order[i]
+		if o.Index>=len(caps) || !caps[o.Index].CanOrder(o) { return false }
+	}
+	return true
+}
+
+func isOrderError(err error) bool {
+	var code table.ErrCode
+	switch v := err.(type) {
+	case table.ScanError: code = v.ErrCode
+	case *table.ScanError: code = v.ErrCode
+	default: return false
+	}
+	switch code {
+	case table.E_ORDERBY_FIELD,table.E_ORDERBY_ORDER_FIELD,table.E_ORDERBY_ORDER: return true
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package driverutil_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Neither memTables nor keyTables order their scans, so the driver sorts the rows.
+func TestSort(t *testing.T) {
+	mdb, md := openTestDB(t)
+	kdb, _ := openKeyDB(t)
+	mt := md.Sch.Get("fruit").(*memTable)
+	*mt.rows = append(*mt.rows, []interface{}{"kiwi", nil}, []interface{}{"date", int64(5)})
+	for _, c := range []struct {
+		db    *sql.DB
+		query string
+		want  []string
+	}{
+		{kdb, "select name from fruit order by qty desc", []string{"cherry", "banana", "apple"}},
+		{kdb, "select name from fruit where qty > 3 order by name desc", []string{"cherry", "banana"}},
+		{mdb, "select name, qty from fruit order by qty, name desc",
+			[]string{"kiwi|NULL", "apple|3", "date|5", "banana|5", "cherry|7"}},
+		{mdb, "select name from fruit order by qty desc, name limit 2 offset 1", []string{"banana", "date"}},
+	} {
+		if got := queryRows(t, c.db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+// Updates and deletes with an ORDER BY, the table can't serve, modify the first rows in that order.
+func TestSortedUpdate(t *testing.T) {
+	for _, c := range []struct {
+		stmt string
+		want []string
+	}{
+		{"update fruit set qty = 0 order by qty desc limit 1", []string{"apple|3", "banana|5", "cherry|0"}},
+		{"delete from fruit order by name desc limit 2", []string{"apple|3"}},
+	} {
+		db, _ := openKeyDB(t)
+		if _, err := db.Exec(c.stmt); err != nil {
+			t.Fatalf("%s: %v", c.stmt, err)
+		}
+		if got := queryRows(t, db, "select name, qty from fruit"); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.stmt, got, c.want)
+		}
+	}
+}
+
+// ORDER BY over more rows than fit in the sort budget, sorted by an external merge sort.
+func TestExternalSort(t *testing.T) {
+	db, d := openKeyDB(t)
+	dir := t.TempDir()
+	d.SortBudget = 300
+	d.SortTempDir = dir
+	tab := newKeyTable("name", "qty")
+	type row struct {
+		name string
+		qty  int64
+	}
+	var rows []row
+	for i := 0; i < 500; i++ {
+		r := row{fmt.Sprintf("f%03d", (i*7919)%500), int64(i % 13)}
+		rows = append(rows, r)
+		*tab.rows = append(*tab.rows, []interface{}{r.name, r.qty})
+	}
+	d.Sch.Put("big", tab)
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].qty != rows[j].qty {
+			return rows[i].qty > rows[j].qty
+		}
+		return rows[i].name < rows[j].name
+	})
+	var want []string
+	for _, r := range rows {
+		want = append(want, fmt.Sprintf("%s|%d", r.name, r.qty))
+	}
+	if got := queryRows(t, db, "select name, qty from big order by qty desc, name"); !reflect.DeepEqual(got, want) {
+		t.Errorf("order by qty desc, name: got %d rows %v, want %d rows", len(got), got, len(want))
+	}
+	if got := queryRows(t, db, "select name, qty from big order by qty desc, name limit 3 offset 10"); !reflect.DeepEqual(got, want[10:13]) {
+		t.Errorf("with limit: got %v, want %v", got, want[10:13])
+	}
+	if n := tempFiles(t, dir); n != 0 {
+		t.Errorf("%d temporary files left after Close", n)
+	}
+
+	// Closed early, while the runs are being merged.
+	r, err := db.Query("select name from big order by qty, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3 && r.Next(); i++ {
+	}
+	if n := tempFiles(t, dir); n < 2 {
+		t.Errorf("%d temporary files while merging, want several", n)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tempFiles(t, dir); n != 0 {
+		t.Errorf("%d temporary files left after an early Close", n)
+	}
+}
+
+func tempFiles(t *testing.T, dir string) int {
+	t.Helper()
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(ents)
+}
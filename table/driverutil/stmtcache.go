@@ -0,0 +1,128 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package driverutil
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+const DefaultStmtCacheSize = 256
+
+type cacheEntry struct {
+	key string
+	version uint64
+	plan *plan
+}
+
+/*
+An LRU cache of compiled statements, keyed by the normalized query text. An
+entry is only valid for the schema.Schema version, it was compiled against.
+*/
+type stmtCache struct {
+	mu sync.Mutex
+	lru list.List
+	m map[string]*list.Element
+}
+func (c *stmtCache) get(key string,version uint64) *plan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.m[key]
+	if e==nil { return nil }
+	ce := e.Value.(*cacheEntry)
+	if ce.version!=version {
+		c.lru.Remove(e)
+		delete(c.m,key)
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return ce.plan
+}
+func (c *stmtCache) put(key string,version uint64,p *plan,size int) {
+	if size==0 { size = DefaultStmtCacheSize }
+	if size<0 { return }
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m==nil { c.m = make(map[string]*list.Element) }
+	if e := c.m[key]; e!=nil {
+		e.Value = &cacheEntry{key,version,p}
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.m[key] = c.lru.PushFront(&cacheEntry{key,version,p})
+	for c.lru.Len()>size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.m,e.Value.(*cacheEntry).key)
+	}
+}
+
+/*
+Collapses every run of whitespace and comments outside of quotes into a single
+space and trims the query, so that equivalent queries share a cache entry.
+Comments are recognized as by the sqlparser tokenizer: "--", "#" and "//" up
+to the end of the line, and block comments. MySQL specific comments, which
+start with "/*!", are kept, as their content is parsed.
+*/
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	var quote byte
+	space,escape := false,false
+	query = strings.TrimSpace(query)
+	for i := 0; i<len(query); i++ {
+		c := query[i]
+		switch {
+		case quote==0:
+			rest := query[i:]
+			switch {
+			case c==' ',c=='\t',c=='\n',c=='\r',c=='\f',c=='\v':
+				space = true
+				continue
+			case strings.HasPrefix(rest,"--"),strings.HasPrefix(rest,"//"),c=='#':
+				n := strings.IndexByte(rest,'\n')
+				if n<0 { n = len(rest) }
+				i += n-1
+				space = true
+				continue
+			case strings.HasPrefix(rest,"/*") && !strings.HasPrefix(rest,"/*!"):
+				n := strings.Index(rest[2:],"*/")
+				if n<0 { n = len(rest) } else { n += 4 }
+				i += n-1
+				space = true
+				continue
+			case c=='\'',c=='"',c=='`': quote = c
+			}
+		case escape: escape = false
+		case c=='\\': escape = true
+		case c==quote: quote = 0
+		}
+		if space {
+			if b.Len()>0 { b.WriteByte(' ') }
+			space = false
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
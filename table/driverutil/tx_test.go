@@ -0,0 +1,132 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package driverutil_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/mad-day/db-utils/table/driverutil"
+)
+
+// Changes within a transaction are visible to it alone, until it is committed.
+func TestTx(t *testing.T) {
+	db, _ := openTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("delete from fruit where name = ?", "apple"); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, tx, "select name from fruit"); len(got) != 2 {
+		t.Errorf("within the transaction: %v", got)
+	}
+	if got := queryRows(t, db, "select name from fruit"); len(got) != 3 {
+		t.Errorf("outside the transaction: %v", got)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select name from fruit"); len(got) != 3 {
+		t.Errorf("after rollback: %v", got)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("update fruit set qty = 0 where name = ?", "apple"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select name from fruit where qty = 0"); !reflect.DeepEqual(got, []string{"apple"}) {
+		t.Errorf("after commit: %v", got)
+	}
+	if err := tx.Commit(); err != sql.ErrTxDone {
+		t.Errorf("second commit: %v", err)
+	}
+}
+
+// A statement prepared within a transaction must not run after the transaction is finished.
+func TestTxStmtAfterCommit(t *testing.T) {
+	db, d := openTestDB(t)
+	conn := d.NewConn()
+	defer conn.Close()
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel, err := conn.Prepare("select name from fruit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sel.Close()
+	upd, err := conn.Prepare("update fruit set qty = 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upd.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sel.(driver.StmtQueryContext).QueryContext(context.Background(), nil); err != sql.ErrTxDone {
+		t.Errorf("query after commit: %v", err)
+	}
+	if _, err := upd.(driver.StmtExecContext).ExecContext(context.Background(), nil); err != sql.ErrTxDone {
+		t.Errorf("exec after commit: %v", err)
+	}
+	if got := queryRows(t, db, "select name from fruit where qty = 0"); len(got) != 0 {
+		t.Errorf("rows updated after commit: %v", got)
+	}
+}
+
+// The Database itself is a driver.Conn, whose statements run in auto-commit mode.
+func TestDatabaseConn(t *testing.T) {
+	_, d := openTestDB(t)
+	db := sql.OpenDB(dbConnector{d})
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("update fruit set qty = 1 where name = 'apple'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryRows(t, db, "select name from fruit where qty = 1"); len(got) != 1 {
+		t.Errorf("got %v", got)
+	}
+}
+
+type dbConnector struct{ d *driverutil.Database }
+
+func (c dbConnector) Connect(context.Context) (driver.Conn, error) { return c.d, nil }
+func (c dbConnector) Driver() driver.Driver                        { return nil }
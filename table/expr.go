@@ -0,0 +1,116 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package table
+
+import "fmt"
+import "strings"
+
+type ExprOp int
+const (
+	E_VALUE ExprOp = iota
+	E_COLUMN
+	E_UNARY
+	E_BINARY
+	E_CASE
+	E_FUNC
+	E_CONVERT
+	E_LIST
+)
+
+/*
+A node of a scalar expression tree, evaluated over the columns of a row.
+
+	E_VALUE    The constant 'Value'.
+	E_COLUMN   The value of the column 'Index'.
+	E_UNARY    'Operator' applied to Args[0]: "-", "+", "~", "!", or one
+	           of the "is null", "is not null", "is true"... operators.
+	E_BINARY   Args[0] 'Operator' Args[1]: Arithmetic ("+", "-", "*", "/",
+	           "div", "%", "&", "|", "^", "<<", ">>"), logic ("and", "or",
+	           "xor") or any comparison operator of ColumnFilter. For
+	           "like" and "not like", 'Value' holds the escape character.
+	E_CASE     CASE Args[0] WHEN Args[1] THEN Args[2] ... ELSE Args[n-1].
+	           Args[0] is nil for a searched CASE, Args[n-1] is nil if
+	           there is no ELSE.
+	E_FUNC     The function 'Operator' applied to 'Args'. 'Value' holds its
+	           ScalarFunc.
+	E_CONVERT  Args[0] converted to the type 'Operator' ("signed", "char"...)
+	E_LIST     The list of 'Args', the right operand of "in" and "not in".
+*/
+type Expression struct {
+	Op       ExprOp
+	Operator string
+	Index    int
+	Value    interface{}
+	Args     []*Expression
+}
+
+// The implementation of a scalar function, see E_FUNC.
+type ScalarFunc func(args []interface{}) (interface{},error)
+
+func (e *Expression) String() string {
+	if e==nil { return "<nil>" }
+	args := make([]string,len(e.Args))
+	for i,a := range e.Args { args[i] = a.String() }
+	switch e.Op {
+	case E_VALUE: return toString(e.Value)
+	case E_COLUMN: return fmt.Sprintf("$%d",e.Index)
+	case E_UNARY:
+		if strings.HasPrefix(e.Operator,"is ") { return fmt.Sprintf("(%s %s)",args[0],e.Operator) }
+		return fmt.Sprintf("%s%s",e.Operator,args[0])
+	case E_BINARY: return fmt.Sprintf("(%s %s %s)",args[0],e.Operator,args[1])
+	case E_CASE: return fmt.Sprintf("case(%s)",strings.Join(args,", "))
+	case E_FUNC: return fmt.Sprintf("%s(%s)",e.Operator,strings.Join(args,", "))
+	case E_CONVERT: return fmt.Sprintf("cast(%s as %s)",args[0],e.Operator)
+	case E_LIST: return fmt.Sprintf("(%s)",strings.Join(args,", "))
+	}
+	return fmt.Sprintf("op_%d(%s)",int(e.Op),strings.Join(args,", "))
+}
+
+// Returns a deep copy of the tree.
+func (e *Expression) Clone() *Expression {
+	if e==nil { return nil }
+	ne := *e
+	if e.Args!=nil {
+		ne.Args = make([]*Expression,len(e.Args))
+		for i,a := range e.Args { ne.Args[i] = a.Clone() }
+	}
+	return &ne
+}
+
+// Calls 'f' on every node of the tree.
+func (e *Expression) Walk(f func(n *Expression)) {
+	if e==nil { return }
+	f(e)
+	for _,a := range e.Args { a.Walk(f) }
+}
+
+// Appends the columns, referenced by the expression, to 'cols' unless already present.
+func (e *Expression) Columns(cols []int) []int {
+	e.Walk(func(n *Expression) {
+		if n.Op!=E_COLUMN { return }
+		for _,i := range cols { if i==n.Index { return } }
+		cols = append(cols,n.Index)
+	})
+	return cols
+}
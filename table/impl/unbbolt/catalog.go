@@ -0,0 +1,157 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package ubbolt
+
+import (
+	bolt "github.com/maxymania/go-unstable/bbolt"
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/driverutil"
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/mad-day/db-utils/table/util"
+	"encoding/json"
+	"fmt"
+)
+
+// The bucket, that holds the table definitions of a database file.
+var CatalogBucket = []byte("__catalog__")
+
+// A table definition within the CatalogBucket, encoded as JSON.
+type tableDef struct {
+	Bucket []byte           `json:"bucket"`
+	Fields []string         `json:"fields"`
+	Types  []util.ValueType `json:"types"`
+	AutoIncrement bool      `json:"auto_increment,omitempty"`
+}
+
+// Stores the definition of 'tab' as table 'name' in the catalog of its database.
+func SaveTable(name string,tab *DBTable) error {
+	def := tableDef{Bucket:tab.Bucket,Fields:tab.Fields,AutoIncrement:tab.AutoIncrement}
+	for i,t := range tab.Types {
+		vt,ok := util.ValueTypeOf(t)
+		if !ok { return fmt.Errorf("column %s: unsupported type %v",tab.Fields[i],t) }
+		def.Types = append(def.Types,vt)
+	}
+	data,err := json.Marshal(&def)
+	if err!=nil { return err }
+	return tab.DB.Update(func(tx *bolt.Tx) error {
+		bkt,err := tx.CreateBucketIfNotExists(CatalogBucket)
+		if err!=nil { return err }
+		if _,err = tx.CreateBucketIfNotExists(tab.Bucket); err!=nil { return err }
+		return bkt.Put([]byte(name),data)
+	})
+}
+
+// Puts every table of the catalog of 'db' into the schema.
+func LoadCatalog(db *bolt.DB,sch *schema.Schema) error {
+	return db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(CatalogBucket)
+		if bkt==nil { return nil }
+		cur := bkt.Cursor()
+		for k,v := cur.First(); k!=nil; k,v = cur.Next() {
+			var def tableDef
+			if err := json.Unmarshal(v,&def); err!=nil { return fmt.Errorf("table %s: %v",k,err) }
+			tab := &DBTable{DB:db,Bucket:def.Bucket,Fields:def.Fields,AutoIncrement:def.AutoIncrement}
+			for _,vt := range def.Types {
+				if vt>util.VT_TIMESTAMP { return fmt.Errorf("table %s: invalid type %d",k,vt) }
+				tab.Types = append(tab.Types,vt.Type())
+			}
+			sch.Put(string(k),tab)
+		}
+		return nil
+	})
+}
+
+/*
+Creates and drops the tables of a bbolt file as schema.TableFactory. Each
+table is stored in a bucket named after the table, the first column is the
+key and must be of a text, binary or integer type. Only an integer key may
+be AUTO_INCREMENT.
+*/
+type Factory struct {
+	DB *bolt.DB
+}
+func (f *Factory) CreateTable(def *schema.TableDef) (table.Table,error) {
+	if len(def.Columns)==0 { return nil,fmt.Errorf("table %s: no columns",def.Name) }
+	for _,i := range def.PrimaryKey {
+		if i!=0 || len(def.PrimaryKey)!=1 { return nil,fmt.Errorf("table %s: the primary key must be the first column",def.Name) }
+	}
+	tab := &DBTable{DB:f.DB,Bucket:[]byte(def.Name)}
+	for i,col := range def.Columns {
+		vt,ok := util.ValueTypeByName(col.Type)
+		if !ok { return nil,fmt.Errorf("column %s: unsupported type %s",col.Name,col.Type) }
+		switch {
+		case i==0 && vt!=util.VT_BYTES && vt!=util.VT_STRING && vt!=util.VT_INT:
+			return nil,fmt.Errorf("column %s: the key must be of a text, binary or integer type",col.Name)
+		case col.AutoIncrement && (i!=0 || vt!=util.VT_INT):
+			return nil,fmt.Errorf("column %s: only an integer key can be auto increment",col.Name)
+		}
+		if col.AutoIncrement { tab.AutoIncrement = true }
+		tab.Fields = append(tab.Fields,col.Name)
+		tab.Types = append(tab.Types,vt.Type())
+	}
+	if err := SaveTable(def.Name,tab); err!=nil { return nil,err }
+	return tab,nil
+}
+func (f *Factory) DropTable(name string,t table.Table) error {
+	tab,ok := t.(*DBTable)
+	if !ok || tab.DB!=f.DB { return fmt.Errorf("table %s: not a table of this database",name) }
+	return f.DB.Update(func(tx *bolt.Tx) error {
+		if bkt := tx.Bucket(CatalogBucket); bkt!=nil {
+			if err := bkt.Delete([]byte(name)); err!=nil { return err }
+		}
+		err := tx.DeleteBucket(tab.Bucket)
+		if err==bolt.ErrBucketNotFound { err = nil }
+		return err
+	})
+}
+func (f *Factory) TruncateTable(name string,t table.Table) error {
+	tab,ok := t.(*DBTable)
+	if !ok || tab.DB!=f.DB { return fmt.Errorf("table %s: not a table of this database",name) }
+	return f.DB.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(tab.Bucket)
+		if err!=nil && err!=bolt.ErrBucketNotFound { return err }
+		_,err = tx.CreateBucket(tab.Bucket)
+		return err
+	})
+}
+
+/*
+Opens a bbolt file as driverutil.Database with the tables of its catalog.
+It is registered as driverutil.Opener for DSNs like "ubbolt:/path/to/file".
+*/
+func OpenDatabase(path string) (*driverutil.Database,error) {
+	db,err := bolt.Open(path,0600,nil)
+	if err!=nil { return nil,err }
+	d := new(driverutil.Database)
+	d.Sch.Factory = &Factory{db}
+	if err = LoadCatalog(db,&d.Sch); err!=nil {
+		db.Close()
+		return nil,err
+	}
+	return d,nil
+}
+
+func init() {
+	driverutil.RegisterOpener("ubbolt",OpenDatabase)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package ubbolt
+
+import (
+	bolt "github.com/maxymania/go-unstable/bbolt"
+	"github.com/mad-day/db-utils/table"
+	"context"
+	"fmt"
+)
+
+type boltTx struct {
+	db *bolt.DB
+	tx *bolt.Tx
+}
+func (b *boltTx) Commit() error { return b.tx.Commit() }
+func (b *boltTx) Rollback() error { return b.tx.Rollback() }
+
+// A DBTable bound to a shared transaction. See DBTable.WithTx().
+type txTable struct {
+	db *DBTable
+	tx *bolt.Tx
+}
+func (t *txTable) Columns() []string { return t.db.Fields }
+func (t *txTable) ScanCaps() []table.ColumnCaps { return t.db.ScanCaps() }
+func (t *txTable) ColumnTypes() []table.ColumnType { return t.db.ColumnTypes() }
+func (t *txTable) AutoIncrementColumn() int { return t.db.AutoIncrementColumn() }
+func (t *txTable) ExplainScan(meta *table.TableScan) string { return t.db.ExplainScan(meta) }
+func (t *txTable) TableScan(cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	return t.db.scan(t.tx,cols,meta)
+}
+func (t *txTable) TableScanContext(ctx context.Context,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	return t.db.scanContext(ctx,t.tx,cols,meta)
+}
+func (t *txTable) TablePrepareUpdate(tu *table.TableUpdate) (table.TableUpdateStmt,error) {
+	return t.db.prepareUpdate(t.tx,tu)
+}
+func (t *txTable) TablePrepareInsert(ti *table.TableInsert) (table.TableInsertStmt,error) {
+	return t.db.prepareInsert(t.tx,ti)
+}
+
+// Tables sharing the same *bolt.DB share one transaction.
+func (db *DBTable) TxResource() interface{} { return db.DB }
+func (db *DBTable) TxBegin(writable bool) (table.Tx,error) {
+	tx,err := db.DB.Begin(writable)
+	if err!=nil { return nil,err }
+	return &boltTx{db.DB,tx},nil
+}
+func (db *DBTable) WithTx(tx table.Tx) (table.Table,error) {
+	btx,ok := tx.(*boltTx)
+	if !ok || btx.db!=db.DB { return nil,fmt.Errorf("transaction does not belong to this database") }
+	return &txTable{db,btx.tx},nil
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/mad-day/db-utils/table"
 	"github.com/byte-mug/golibs/msgpackx"
 	"reflect"
+	"context"
 	"fmt"
 	"io"
 	"bytes"
@@ -39,14 +40,18 @@ type tableI struct {
 	cur *bolt.Cursor
 	key,val,end []byte
 	pick,incl bool
+	limit,offset int64
 	rec []interface{}
 	active bool
+	shared bool
+	ctx context.Context
 }
 func (t *tableI) discard() {
 	if t.active { return }
 	t.Close()
 }
 func (t *tableI) Close() error {
+	if t.shared { t.tx = nil; return nil }
 	err := t.tx.Rollback()
 	t.tx = nil
 	return err
@@ -66,7 +71,21 @@ func (t *tableI) next() (key,val []byte,err error) {
 	}
 	return
 }
+// Skips the offset and counts down the limit, before the next row is fetched.
+func (t *tableI) bounded() error {
+	if t.ctx!=nil {
+		if err := t.ctx.Err(); err!=nil { return err }
+	}
+	for ; t.offset>0 ; t.offset-- {
+		if _,_,err := t.next(); err!=nil { return err }
+	}
+	if t.limit==0 { return io.EOF }
+	if t.limit>0 { t.limit-- }
+	return nil
+}
+func (t *tableI) LimitApplied() bool { return true }
 func (t *tableI) Next(cols []int,vals []interface{}) error {
+	if err := t.bounded(); err!=nil { return err }
 	key,val,err := t.next()
 	if err!=nil { return err }
 	//t.rec[0] = key
@@ -81,45 +100,83 @@ func (t *tableI) Next(cols []int,vals []interface{}) error {
 func (ti *tableI) tableScan0(fields []string,cols []int,meta *table.TableScan) (*int,error) {
 	var op string
 	var key []byte
+	var err error
+	if meta.Where!=nil { return nil,table.ErrPredicateUnsupp }
+	ti.limit,ti.offset,err = meta.LimitOffset()
+	if err!=nil { return nil,err }
 	for i := range meta.Order {
 		if meta.Order[i].Index != 0 { return nil,meta.Order[i].Err(table.E_ORDERBY_ORDER_FIELD,fields) }
 		if meta.Order[i].Desc { return nil,meta.Order[i].Err(table.E_ORDERBY_ORDER,fields) }
 	}
-	foundFilter := false
+	var lo,hi bound
+	none := false
 	for i := range meta.Filter {
 		if meta.Filter[i].Index != 0 { return nil,meta.Filter[i].Err(table.E_FILTER_FIELD_UNSUPP,fields) }
 		
 		switch meta.Filter[i].Operator {
 		case "=","<=>","<","<=",">",">=":
-			switch v := meta.Filter[i].Value.(type) {
-				case []byte: key = v
-				case string: key = []byte(v)
-			}
 			op = meta.Filter[i].Operator
+			key,err = ti.keyOf(meta.Filter[i].Value)
+			if err!=nil {
+				// No key equals the value, but it might still compare to them.
+				if op=="=" || op=="<=>" { none = true; continue }
+				return nil,meta.Filter[i].Err(table.E_FILTER_OPERATOR_FIELD,fields)
+			}
 			switch op {
 			case "=","<=>":
-				ti.end = key
-				ti.incl = true
-				ti.key,ti.val = ti.cur.Seek(key)
-				ti.pick = true
+				lo.lower(key,true)
+				hi.upper(key,true)
 			case ">",">=":
-				ti.key,ti.val = ti.cur.Seek(key)
-				ti.pick = op==">="
+				lo.lower(key,op==">=")
 			case "<","<=":
-				ti.end = key
-				ti.incl = op=="<="
+				hi.upper(key,op=="<=")
 			}
-			foundFilter = true
 		default: return nil,meta.Filter[i].Err(table.E_FILTER_OPERATOR_UNSUPP,fields)
 		}
 	}
-	if !foundFilter {
-		ti.key,ti.val = ti.cur.First()
+	if none {
+		ti.key,ti.val,ti.end = nil,nil,nil
 		ti.pick = true
+	} else {
+		ti.seek(&lo,&hi)
 	}
 	return nil,nil
 }
 
+// Converts a filter value to the type of the key column and encodes it.
+func (ti *tableI) keyOf(v interface{}) ([]byte,error) {
+	v,err := util.Coerce(v,&table.ColumnType{ScanType:reflect.TypeOf(ti.rec[0]).Elem()})
+	if err!=nil { return nil,err }
+	if key,ok := util.KeyOf(v); ok { return key,nil }
+	return nil,fmt.Errorf("not a key: %v",v)
+}
+
+// A bound of a key range. The tightest one of several filters is kept.
+type bound struct {
+	key []byte
+	incl,set bool
+}
+func (b *bound) lower(key []byte,incl bool) {
+	c := bytes.Compare(key,b.key)
+	if !b.set || c>0 || (c==0 && !incl) { *b = bound{key,incl,true} }
+}
+func (b *bound) upper(key []byte,incl bool) {
+	c := bytes.Compare(key,b.key)
+	if !b.set || c<0 || (c==0 && !incl) { *b = bound{key,incl,true} }
+}
+
+// Positions the cursor at the lower bound, or the first key, if there is none.
+func (ti *tableI) seek(lo,hi *bound) {
+	ti.end,ti.incl = hi.key,hi.incl
+	if !lo.set {
+		ti.key,ti.val = ti.cur.First()
+		ti.pick = true
+		return
+	}
+	ti.key,ti.val = ti.cur.Seek(lo.key)
+	ti.pick = lo.incl || !bytes.Equal(ti.key,lo.key)
+}
+
 type placer struct {
 	bolt.VisitorDefault
 	op bolt.VisitOp
@@ -130,17 +187,28 @@ func (p *placer) VisitEmpty(key []byte) bolt.VisitOp { return p.op }
 type tableM struct {
 	tableI
 	buf []interface{}
+	fields []string
 }
 func (t *tableM) Close() error {
+	if t.shared || t.tx==nil { t.tx = nil; return nil }
 	err := t.tx.Commit()
 	t.tx = nil
 	return err
 }
 func (t *tableM) Abort() error {
+	if t.shared || t.tx==nil { t.tx = nil; return nil }
 	err := t.tx.Rollback()
 	t.tx = nil
 	return err
 }
+// Stops with ctx.Err(), once 'ctx' is done, rolling back an own transaction.
+func (t *tableM) TableUpdateContext(ctx context.Context,tu *table.TableUpdate) (*table.ModifyResult,error) {
+	t.ctx = ctx
+	defer func() { t.ctx = nil }()
+	res,err := t.TableUpdate(tu)
+	if err!=nil && err==ctx.Err() { t.Abort() }
+	return res,err
+}
 func (t *tableM) TableUpdate(tu *table.TableUpdate) (*table.ModifyResult,error) {
 	if _,err := t.tableScan0(nil,nil,tu.Scan); err!=nil { return nil,err }
 	
@@ -148,15 +216,27 @@ func (t *tableM) TableUpdate(tu *table.TableUpdate) (*table.ModifyResult,error)
 	var cnt int64
 	switch tu.Op {
 	case table.T_Update:
+		var m util.Matcher
+		cols := make([]int,len(t.rec))
+		for i := range cols { cols[i] = i }
+		old := make([]interface{},len(t.rec))
+		upd := make([]interface{},len(tu.UpdVals))
 		for {
-			_,val,err := t.next()
+			err := t.bounded()
 			if err==io.EOF { return &table.ModifyResult{nil,&cnt},nil }
 			if err!=nil { return nil,err }
+			key,val,err := t.next()
+			if err==io.EOF { return &table.ModifyResult{nil,&cnt},nil }
+			if err!=nil { return nil,err }
+			util.SetInKey(t.rec[0],key)
 			err = msgpackx.Unmarshal(val,t.rec[1:]...)
 			if err!=nil { return nil,err }
+			for i := range old { old[i] = util.GetPtr(t.rec[i]) }
+			err = m.UpdateValues(tu,cols,old,upd)
+			if err!=nil { return nil,err }
 			for i,j := range tu.UpdCols {
-				err = util.SetInPtr(t.rec[j],tu.UpdVals[i])
-				fmt.Println(i,j,err)
+				err = util.SetInPtr(t.rec[j],upd[i])
+				if err!=nil { return nil,fmt.Errorf("column %s: %v",t.fields[j],err) }
 			}
 			for i := range t.buf {
 				t.buf[i] = util.GetPtr(t.rec[i+1])
@@ -171,7 +251,10 @@ func (t *tableM) TableUpdate(tu *table.TableUpdate) (*table.ModifyResult,error)
 	case table.T_Delete:
 		p.op = bolt.VisitOpDELETE()
 		for {
-			_,_,err := t.next()
+			err := t.bounded()
+			if err==io.EOF { return &table.ModifyResult{nil,&cnt},nil }
+			if err!=nil { return nil,err }
+			_,_,err = t.next()
 			if err==io.EOF { return &table.ModifyResult{nil,&cnt},nil }
 			if err!=nil { return nil,err }
 			err = t.cur.Accept(p,true)
@@ -193,9 +276,17 @@ type tableC struct {
 	rec,orig []interface{}
 	buf []interface{}
 	active bool
+	shared bool
 	err error
-	updCols []int
-	updVals []interface{}
+	ctx context.Context
+	
+	// The current insert, and the rows affected by the current row.
+	ti *table.TableInsert
+	affected int64
+	m util.Matcher
+	
+	// Column 0 is generated from the bucket's sequence.
+	autoInc bool
 }
 
 func (t *tableC) encode() ([]byte,error) {
@@ -211,26 +302,42 @@ func (t *tableC) errOp(err error) (op bolt.VisitOp) {
 func (t *tableC) VisitEmpty(key []byte) (op bolt.VisitOp) {
 	val,err := t.encode()
 	if err!=nil { return t.errOp(err) }
+	t.affected = 1
 	return bolt.VisitOpSET(val)
 }
 func (t *tableC) VisitFull(key, value []byte) bolt.VisitOp {
-	switch t.op {
+	switch t.ti.Op {
 	case table.T_Insert:
-		if len(t.updCols)!=0 { goto upd }
+		if len(t.ti.OndupCols)!=0 { return t.update(key,value) }
 		t.err = table.ErrDuplicateKey
-		fallthrough
-	case table.T_InsertIgnore: return bolt.VisitOp{}
 	case table.T_Replace:
-		return t.VisitEmpty(key)
+		op := t.VisitEmpty(key)
+		t.affected = 2
+		return op
 	}
-	upd:
-	err := msgpackx.Unmarshal(value,t.buf[1:])
+	return bolt.VisitOp{}
+}
+// ON DUPLICATE KEY UPDATE: Updates the existing row 'value'.
+func (t *tableC) update(key, value []byte) bolt.VisitOp {
+	ins := make([]interface{},len(t.rec))
+	for i,p := range t.rec {
+		v := util.GetPtr(p)
+		if b,ok := v.([]byte); ok { v = append([]byte(nil),b...) }
+		ins[i] = v
+	}
+	err := msgpackx.Unmarshal(value,t.rec[1:]...)
 	if err!=nil { return t.errOp(err) }
-	for i,j := range t.updCols {
-		err = util.SetInPtr(t.rec[j],t.updVals[i])
+	old := make([]interface{},len(t.rec))
+	for i,p := range t.rec { old[i] = util.GetPtr(p) }
+	upd := make([]interface{},len(t.ti.OndupCols))
+	if err = t.m.OndupValues(t.ti,old,ins,upd); err!=nil { return t.errOp(err) }
+	for i,j := range t.ti.OndupCols {
+		err = util.SetInPtr(t.rec[j],upd[i])
 		if err!=nil { return t.errOp(err) }
 	}
-	return t.VisitEmpty(key)
+	op := t.VisitEmpty(key)
+	t.affected = 2
+	return op
 }
 
 func (t *tableC) discard() {
@@ -238,19 +345,48 @@ func (t *tableC) discard() {
 	t.Abort()
 }
 func (t *tableC) Close() error {
+	if t.shared || t.tx==nil { t.tx = nil; return nil }
 	err := t.tx.Commit()
 	t.tx = nil
 	return err
 }
 func (t *tableC) Abort() error {
+	if t.shared || t.tx==nil { t.tx = nil; return nil }
 	err := t.tx.Rollback()
 	t.tx = nil
 	return err
 }
+// Stops with ctx.Err(), once 'ctx' is done, rolling back an own transaction.
+func (t *tableC) TableInsertContext(ctx context.Context,ti *table.TableInsert) (*table.ModifyResult,error) {
+	t.ctx = ctx
+	defer func() { t.ctx = nil }()
+	res,err := t.TableInsert(ti)
+	if err!=nil && err==ctx.Err() { t.Abort() }
+	return res,err
+}
+/*
+Generates the key of the current row, if it is 0, and returns it. Otherwise,
+the sequence is advanced past the given key, and 0 is returned.
+*/
+func (t *tableC) sequence() (int64,error) {
+	k := t.rec[0].(*int64)
+	if *k!=0 {
+		if *k>0 && uint64(*k)>t.bkt.Sequence() { return 0,t.bkt.SetSequence(uint64(*k)) }
+		return 0,nil
+	}
+	seq,err := t.bkt.NextSequence()
+	if err!=nil { return 0,err }
+	*k = int64(seq)
+	return *k,nil
+}
 func (t *tableC) TableInsert(ti *table.TableInsert) (tm *table.ModifyResult,err error) {
 	var key []byte
 	var cnt int64
+	var lastId *int64
 	for _,value := range ti.Values {
+		if t.ctx!=nil {
+			if err = t.ctx.Err(); err!=nil { return }
+		}
 		for i,p := range t.rec { util.SetInPtr(p,t.orig[i]) }
 		if ti.AllCols {
 			for i,p := range t.rec {
@@ -263,32 +399,90 @@ func (t *tableC) TableInsert(ti *table.TableInsert) (tm *table.ModifyResult,err
 				if err!=nil { return }
 			}
 		}
+		if t.autoInc {
+			var id int64
+			id,err = t.sequence()
+			if err!=nil { return }
+			if lastId==nil && id!=0 { lastId = &id }
+		}
 		key,err = util.GetKey(t.rec[0])
 		if err!=nil { return }
+		t.ti,t.affected,t.err = ti,0,nil
 		err = t.bkt.Accept(key,t,true)
-		cnt++
+		cnt += t.affected
 		if err!=nil { return }
 		if t.err!=nil { return nil,t.err }
 	}
-	tm = &table.ModifyResult{nil,&cnt}
+	tm = &table.ModifyResult{lastId,&cnt}
 	return
 }
 
 
+/*
+A table, stored in a bucket. Column 0 is the key, of type []byte, string or
+int64. Integer keys are stored in an order-preserving encoding.
+*/
 type DBTable struct {
 	DB *bolt.DB
 	Bucket []byte
 	Fields []string
 	Types  []reflect.Type
+	
+	// If true, the int64 key is generated from the bucket's sequence, when
+	// an insert omits it or sets it to 0.
+	AutoIncrement bool
+}
+
+func (db *DBTable) AutoIncrementColumn() int {
+	if db.AutoIncrement { return 0 }
+	return -1
 }
 
 func (db *DBTable) Columns() []string {
 	return db.Fields
 }
-func (db *DBTable) iter() (*tableI,error) {
-	tx,err := db.DB.Begin(false)
+// Columns can't be NULL, as NULL is stored as the zero value.
+func (db *DBTable) ColumnTypes() []table.ColumnType {
+	cts := make([]table.ColumnType,len(db.Types))
+	for i,t := range db.Types {
+		if vt,ok := util.ValueTypeOf(t); ok {
+			cts[i] = vt.ColumnType(false)
+		} else {
+			cts[i] = table.ColumnType{ScanType:t,NullableKnown:true}
+		}
+	}
+	return cts
+}
+// Begins a new transaction, unless a shared transaction is given.
+func (db *DBTable) begin(stx *bolt.Tx,writable bool) (*bolt.Tx,error) {
+	if stx!=nil { return stx,nil }
+	return db.DB.Begin(writable)
+}
+// Only the key (column 0) can be filtered and ordered (ascending).
+func (db *DBTable) ScanCaps() []table.ColumnCaps {
+	caps := make([]table.ColumnCaps,len(db.Fields))
+	if len(caps)!=0 {
+		caps[0].Operators = []string{"=","<=>","<","<=",">",">="}
+		caps[0].Asc = true
+	}
+	return caps
+}
+// Filters on the key seek to or range over the keys, anything else scans the whole bucket.
+func (db *DBTable) ExplainScan(meta *table.TableScan) string {
+	path := "full scan"
+	for _,f := range meta.Filter {
+		if f.Index!=0 { continue }
+		switch f.Operator {
+		case "=","<=>": return "key seek"
+		case "<","<=",">",">=": path = "range scan"
+		}
+	}
+	return path
+}
+func (db *DBTable) iter(stx *bolt.Tx) (*tableI,error) {
+	tx,err := db.begin(stx,false)
 	if err!=nil { return nil,err }
-	tbl := &tableI{tx:tx}
+	tbl := &tableI{tx:tx,shared:stx!=nil}
 	defer tbl.discard()
 	bkt := tx.Bucket(db.Bucket)
 	if bkt==nil { return nil,fmt.Errorf("Bucket not found: %q",db.Bucket) }
@@ -301,10 +495,10 @@ func (db *DBTable) iter() (*tableI,error) {
 	tbl.active = true
 	return tbl,nil
 }
-func (db *DBTable) modify() (*tableM,error) {
-	tx,err := db.DB.Begin(true)
+func (db *DBTable) modify(stx *bolt.Tx) (*tableM,error) {
+	tx,err := db.begin(stx,true)
 	if err!=nil { return nil,err }
-	tbl := &tableM{tableI{tx:tx},nil}
+	tbl := &tableM{tableI{tx:tx,shared:stx!=nil},nil,db.Fields}
 	defer tbl.discard()
 	bkt,err := tx.CreateBucketIfNotExists(db.Bucket)
 	if err!=nil { return nil,err }
@@ -318,10 +512,10 @@ func (db *DBTable) modify() (*tableM,error) {
 	tbl.active = true
 	return tbl,nil
 }
-func (db *DBTable) creator() (*tableC,error) {
-	tx,err := db.DB.Begin(true)
+func (db *DBTable) creator(stx *bolt.Tx) (*tableC,error) {
+	tx,err := db.begin(stx,true)
 	if err!=nil { return nil,err }
-	tbl := &tableC{tx:tx}
+	tbl := &tableC{tx:tx,shared:stx!=nil}
 	defer tbl.discard()
 	bkt,err := tx.CreateBucketIfNotExists(db.Bucket)
 	if err!=nil { return nil,err }
@@ -338,8 +532,18 @@ func (db *DBTable) creator() (*tableC,error) {
 	return tbl,nil
 }
 func (db *DBTable) TableScan(cols []int,meta *table.TableScan) (table.TableIterator,error) {
-	ti,err := db.iter()
+	return db.scan(nil,cols,meta)
+}
+func (db *DBTable) TableScanContext(ctx context.Context,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	return db.scanContext(ctx,nil,cols,meta)
+}
+func (db *DBTable) scan(stx *bolt.Tx,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	return db.scanContext(nil,stx,cols,meta)
+}
+func (db *DBTable) scanContext(ctx context.Context,stx *bolt.Tx,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	ti,err := db.iter(stx)
 	if err!=nil { return nil,err }
+	ti.ctx = ctx
 	defer ti.discard()
 	ti.active = false
 	//_,err = db.tableScan(ti,cols,meta)
@@ -349,8 +553,11 @@ func (db *DBTable) TableScan(cols []int,meta *table.TableScan) (table.TableItera
 	return ti,nil
 }
 func (db *DBTable) TablePrepareUpdate(tu *table.TableUpdate) (table.TableUpdateStmt,error) {
+	return db.prepareUpdate(nil,tu)
+}
+func (db *DBTable) prepareUpdate(stx *bolt.Tx,tu *table.TableUpdate) (table.TableUpdateStmt,error) {
 	for _,j := range tu.UpdCols { if j==0 { return nil,fmt.Errorf("Trying to update the primary key") } }
-	ti,err := db.modify()
+	ti,err := db.modify(stx)
 	if err!=nil { return nil,err }
 	//defer ti.discard()
 	//ti.active = false
@@ -369,7 +576,7 @@ func (db *DBTable) tableScan(ti *tableI,cols []int,meta *table.TableScan) (*int,
 		if meta.Order[i].Index != 0 { return nil,meta.Order[i].Err(table.E_ORDERBY_ORDER_FIELD,db.Fields) }
 		if meta.Order[i].Desc { return nil,meta.Order[i].Err(table.E_ORDERBY_ORDER,db.Fields) }
 	}
-	foundFilter := false
+	var lo,hi bound
 	for i := range meta.Filter {
 		if meta.Filter[i].Index != 0 { return nil,meta.Filter[i].Err(table.E_FILTER_FIELD_UNSUPP,db.Fields) }
 		
@@ -382,41 +589,37 @@ func (db *DBTable) tableScan(ti *tableI,cols []int,meta *table.TableScan) (*int,
 			op = meta.Filter[i].Operator
 			switch op {
 			case "=","<=>":
-				ti.end = key
-				ti.incl = true
-				ti.key,ti.val = ti.cur.Seek(key)
-				ti.pick = true
+				lo.lower(key,true)
+				hi.upper(key,true)
 			case ">",">=":
-				ti.key,ti.val = ti.cur.Seek(key)
-				ti.pick = op==">="
+				lo.lower(key,op==">=")
 			case "<","<=":
-				ti.end = key
-				ti.incl = op=="<="
+				hi.upper(key,op=="<=")
 			}
-			foundFilter = true
 		default: return nil,meta.Filter[i].Err(table.E_FILTER_OPERATOR_UNSUPP,db.Fields)
 		}
 	}
-	if !foundFilter {
-		ti.key,ti.val = ti.cur.First()
-		ti.pick = true
-	}
+	ti.seek(&lo,&hi)
 	return nil,nil
 	*/
 }
 
 func (db *DBTable) TablePrepareInsert(ti *table.TableInsert) (table.TableInsertStmt,error) {
-	tc,err := db.creator()
+	return db.prepareInsert(nil,ti)
+}
+func (db *DBTable) prepareInsert(stx *bolt.Tx,ti *table.TableInsert) (table.TableInsertStmt,error) {
+	tc,err := db.creator(stx)
 	if err!=nil { return nil,err }
 	defer tc.discard()
-	if !ti.AllCols {
+	if db.AutoIncrement {
+		if _,ok := tc.rec[0].(*int64); !ok { return nil,fmt.Errorf("auto increment key must be of type int64") }
+		tc.autoInc = true
+	} else if !ti.AllCols {
 		cnt := 0
 		for _,j := range ti.Cols { if j==0 { cnt++ } }
 		if cnt==0 { return nil,fmt.Errorf("Primary key not specified") }
 	}
 	for _,j := range ti.OndupCols { if j==0 { return nil,fmt.Errorf("Trying to update the primary key") } }
-	tc.updCols = ti.OndupCols
-	tc.updVals = ti.OndupVals
 	return tc,nil
 }
 
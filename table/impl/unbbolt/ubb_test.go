@@ -0,0 +1,328 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package ubbolt_test
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/driverutil"
+	"github.com/mad-day/db-utils/table/impl/unbbolt"
+)
+
+// Opens a new database file with the table fruit(id bigint auto_increment, name, qty).
+func openDB(t *testing.T) *sql.DB {
+	d, err := ubbolt.OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Sch.Factory.(*ubbolt.Factory).DB.Close() })
+	reg := new(driverutil.DbRegistry)
+	reg.RegisterDb(t.Name(), d)
+	c, err := reg.OpenConnector(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	t.Cleanup(func() { db.Close() })
+	exec(t, db, "create table fruit (id bigint auto_increment primary key, name varchar(20), qty bigint)")
+	exec(t, db, "insert into fruit (name, qty) values ('apple', 3), ('banana', 5), ('cherry', 7)")
+	return db
+}
+
+// Executes the statement and returns the number of rows affected, if any.
+func exec(t *testing.T, db *sql.DB, query string, args ...interface{}) int64 {
+	t.Helper()
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	n, _ := res.RowsAffected()
+	return n
+}
+
+// Returns the rows of the query, with the columns of each row joined by "|".
+func query(t *testing.T, db *sql.DB, query string, args ...interface{}) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	var res []string
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		dst := make([]interface{}, len(cols))
+		for i := range dst {
+			dst[i] = &vals[i]
+		}
+		if err := rows.Scan(dst...); err != nil {
+			t.Fatal(err)
+		}
+		strs := make([]string, len(vals))
+		for i, v := range vals {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			strs[i] = fmt.Sprint(v)
+		}
+		res = append(res, strings.Join(strs, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return res
+}
+
+func TestScan(t *testing.T) {
+	db := openDB(t)
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"select name from fruit", []string{"apple", "banana", "cherry"}},
+		{"select name, qty from fruit where id = 2", []string{"banana|5"}},
+		{"select name from fruit where id > 1", []string{"banana", "cherry"}},
+		{"select name from fruit where id >= 2 limit 1", []string{"banana"}},
+		{"select name from fruit where id = 4", nil},
+		{"select name from fruit where id < 3", []string{"apple", "banana"}},
+		{"select name from fruit where id <= 2", []string{"apple", "banana"}},
+		{"select name from fruit where id < 1", nil},
+		{"select name from fruit where id > 0", []string{"apple", "banana", "cherry"}},
+		{"select name from fruit where id > 1 and id < 3", []string{"banana"}},
+		{"select name from fruit where id < 10 and id <= 1", []string{"apple"}},
+		{"select name from fruit where id >= 3 and id > 1", []string{"cherry"}},
+		{"select name from fruit where qty > 4", []string{"banana", "cherry"}},
+		{"select name from fruit where id > 1 and name like '%a%'", []string{"banana"}},
+		{"select name from fruit order by qty desc", []string{"cherry", "banana", "apple"}},
+		{"select name from fruit limit 2 offset 1", []string{"banana", "cherry"}},
+	} {
+		if got := query(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	db := openDB(t)
+	if n := exec(t, db, "update fruit set qty = qty + 1 where id = 1"); n != 1 {
+		t.Errorf("update: %d rows", n)
+	}
+	if n := exec(t, db, "delete from fruit where id = 3"); n != 1 {
+		t.Errorf("delete: %d rows", n)
+	}
+	if n := exec(t, db, "insert into fruit values (10, 'kiwi', 1)"); n != 1 {
+		t.Errorf("insert: %d rows", n)
+	}
+	res, err := db.Exec("insert into fruit (name, qty) values ('lime', 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := res.LastInsertId(); err != nil || id != 11 {
+		t.Errorf("LastInsertId: %d, %v", id, err)
+	}
+	want := []string{"1|apple|4", "2|banana|5", "10|kiwi|1", "11|lime|2"}
+	if got := query(t, db, "select id, name, qty from fruit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCreateIfNotExists(t *testing.T) {
+	db := openDB(t)
+	for i := 0; i < 2; i++ {
+		exec(t, db, "create table if not exists fruit (id bigint primary key)")
+	}
+	if _, err := db.Exec("create table fruit (id bigint primary key)"); err == nil {
+		t.Error("existing table created again")
+	}
+	want := []string{"1|apple|3", "2|banana|5", "3|cherry|7"}
+	if got := query(t, db, "select id, name, qty from fruit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Updates and deletes, whose filters are not on the key, are evaluated row by row.
+func TestResidualModify(t *testing.T) {
+	db := openDB(t)
+	if n := exec(t, db, "update fruit set qty = 0 where qty > 4"); n != 2 {
+		t.Errorf("update: %d rows", n)
+	}
+	if n := exec(t, db, "update fruit set qty = qty + 1 where id = 1 or name = 'cherry'"); n != 2 {
+		t.Errorf("update with or: %d rows", n)
+	}
+	if n := exec(t, db, "delete from fruit where not (name = 'banana')"); n != 2 {
+		t.Errorf("delete: %d rows", n)
+	}
+	want := []string{"2|banana|0"}
+	if got := query(t, db, "select id, name, qty from fruit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Orderings, the table can't serve, are sorted.
+	exec(t, db, "insert into fruit (name, qty) values ('fig', 2), ('lime', 1)")
+	if n := exec(t, db, "delete from fruit order by qty desc limit 1"); n != 1 {
+		t.Errorf("delete ordered by qty: %d rows", n)
+	}
+	if n := exec(t, db, "update fruit set qty = 7 order by id desc limit 1"); n != 1 {
+		t.Errorf("update ordered by id desc: %d rows", n)
+	}
+	want = []string{"2|banana|0", "5|lime|7"}
+	if got := query(t, db, "select id, name, qty from fruit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Filter values on the key are converted to its type. No key equals NULL or a value, that can't be converted.
+func TestKeyFilter(t *testing.T) {
+	db := openDB(t)
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+		want  []string
+	}{
+		{"select name from fruit where id = null", nil, nil},
+		{"select name from fruit where id <=> null", nil, nil},
+		{"select name from fruit where id = ?", []interface{}{nil}, nil},
+		{"select name from fruit where id = 1.5", nil, nil},
+		{"select name from fruit where id = '2'", nil, []string{"banana"}},
+		{"select name from fruit where id = ?", []interface{}{"3"}, []string{"cherry"}},
+		{"select name from fruit where id = '12abc'", nil, nil},
+		{"select name from fruit where id > 1.5", nil, []string{"banana", "cherry"}},
+		{"select name from fruit where id <= 2.5 and id > 1", nil, []string{"banana"}},
+	} {
+		if got := query(t, db, c.query, c.args...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %v: got %v, want %v", c.query, c.args, got, c.want)
+		}
+	}
+	if n := exec(t, db, "update fruit set qty = 0 where id = 1.5"); n != 0 {
+		t.Errorf("update: %d rows", n)
+	}
+	if n := exec(t, db, "delete from fruit where id = null"); n != 0 {
+		t.Errorf("delete: %d rows", n)
+	}
+	if n := exec(t, db, "delete from fruit where id > 2.5"); n != 1 {
+		t.Errorf("delete with range: %d rows", n)
+	}
+	want := []string{"1|apple|3", "2|banana|5"}
+	if got := query(t, db, "select id, name, qty from fruit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// A duplicate key fails only the execution, that inserts it.
+func TestDuplicateKey(t *testing.T) {
+	db := openDB(t)
+	stmt, err := db.Prepare("insert into fruit values (?, ?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(1, "fig", 1); err != table.ErrDuplicateKey {
+		t.Errorf("duplicate key: %v", err)
+	}
+	if _, err := stmt.Exec(20, "fig", 1); err != nil {
+		t.Errorf("new key: %v", err)
+	}
+	if _, err := stmt.Exec(21, "lime", 2); err != nil {
+		t.Errorf("new key: %v", err)
+	}
+	// The statement's transaction is committed, when it is closed.
+	if err := stmt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20|fig|1", "21|lime|2"}
+	if got := query(t, db, "select id, name, qty from fruit where id > 3"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// INSERT ... SELECT reads its source within the transaction, it inserts in.
+func TestInsertSelect(t *testing.T) {
+	db := openDB(t)
+	exec(t, db, "create table basket (id bigint auto_increment primary key, name varchar(20), qty bigint)")
+	if n := exec(t, db, "insert into basket (name, qty) select name, qty from fruit where qty > ?", 4); n != 2 {
+		t.Errorf("insert into basket: %d rows", n)
+	}
+	want := []string{"1|banana|5", "2|cherry|7"}
+	if got := query(t, db, "select id, name, qty from basket"); !reflect.DeepEqual(got, want) {
+		t.Errorf("basket: got %v, want %v", got, want)
+	}
+	// Enough rows, that the database file has to grow.
+	rows := int64(3)
+	for i := 0; i < 10; i++ {
+		if n := exec(t, db, "insert into fruit (name, qty) select name, qty + 1 from fruit"); n != rows {
+			t.Fatalf("insert into fruit: %d rows, want %d", n, rows)
+		}
+		rows *= 2
+	}
+	var n int64
+	if err := db.QueryRow("select count(*) from fruit").Scan(&n); err != nil || n != rows {
+		t.Errorf("count: %d, %v", n, err)
+	}
+}
+
+/*
+UPDATE and INSERT ... SELECT hold their transaction only while they execute,
+and roll it back, if they fail.
+*/
+func TestStatementTx(t *testing.T) {
+	db := openDB(t)
+	stmt, err := db.Prepare("update fruit set qty = qty + 1 where qty > ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(4); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.Exec("insert into fruit (name, qty) values ('kiwi', 1)")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("insert blocked by a prepared update")
+	}
+	if _, err := db.Exec("update fruit set qty = if(id = 2, 'x', 0) where qty > 0"); err == nil {
+		t.Error("update with an invalid value succeeded")
+	}
+	// Inserts the keys 6 and 5, and fails on 4.
+	if _, err := db.Exec("insert into fruit select 7 - id, name, qty from fruit"); err == nil {
+		t.Error("insert of a duplicate key succeeded")
+	}
+	want := []string{"1|apple|3", "2|banana|6", "3|cherry|8", "4|kiwi|1"}
+	if got := query(t, db, "select id, name, qty from fruit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/xwb1989/sqlparser"
+
+// An aggregate function.
+type Aggregate struct {
+	// One of "count", "sum", "min", "max" or "avg".
+	Func     string
+	Distinct bool
+	
+	// The position of the argument in the input row, -1 for COUNT(*).
+	Arg      int
+}
+
+/*
+The aggregation of a select statement. The input rows (see Query) are grouped
+by the columns 'GroupBy', producing an intermediate row per group, that consists of the group columns followed by the aggregates:
+
+	(GroupBy[0], ..., GroupBy[n-1], Aggs[0], ..., Aggs[m-1])
+
+Without 'GroupBy', all rows form a single group, even if there are none.
+
+'Having' and 'Order' refer to positions in the intermediate row, and 'Output'
+selects the result columns from it. If 'Exprs' is not nil, the result columns
+are computed by these expressions over the intermediate row instead. Query.Scan.Limit and Query.Scan.Offset
+apply to the result rather than the table.
+
+If 'OrderResult' is true, 'Order' refers to positions in the result row
+instead, as the query is ordered by a computed result column.
+*/
+type Aggregation struct {
+	GroupBy []int
+	Aggs    []Aggregate
+	Having  *table.Predicate
+	Order   []table.ColumnOrder
+	OrderResult bool
+	Output  []int
+	Exprs   []*table.Expression
+}
+
+var aggregateFuncs = map[string]bool{"count":true,"sum":true,"min":true,"max":true,"avg":true}
+
+func isAggregate(f *sqlparser.FuncExpr) bool {
+	return f.Qualifier.IsEmpty() && aggregateFuncs[f.Name.Lowered()]
+}
+func hasAggregates(exprs sqlparser.SelectExprs) (found bool) {
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool,error) {
+		if f,ok := node.(*sqlparser.FuncExpr); ok && isAggregate(f) { found = true }
+		return !found,nil
+	},exprs)
+	return
+}
+
+// Returns the position of the table column 'i' in c.cols, adding it if necessary.
+func (c *compiler) scanPos(i int) int {
+	for p,j := range c.cols { if i==j { return p } }
+	c.cols = append(c.cols,i)
+	return len(c.cols)-1
+}
+
+// Returns the index of the aggregate in c.agg.Aggs, adding it if necessary.
+func (c *compiler) addAggregate(f *sqlparser.FuncExpr) int {
+	a := Aggregate{Func:f.Name.Lowered(),Distinct:f.Distinct,Arg:-1}
+	if len(f.Exprs)!=1 { panic("invalid aggregate: << "+sqlparser.String(f)+" >>") }
+	switch v := f.Exprs[0].(type) {
+	case *sqlparser.StarExpr:
+		if a.Func!="count" || a.Distinct { panic("invalid aggregate: << "+sqlparser.String(f)+" >>") }
+	case *sqlparser.AliasedExpr:
+		a.Arg = c.inputPos(v.Expr)
+	default:
+		panic("invalid aggregate: << "+sqlparser.String(f)+" >>")
+	}
+	for k,b := range c.agg.Aggs { if a==b { return k } }
+	c.agg.Aggs = append(c.agg.Aggs,a)
+	return len(c.agg.Aggs)-1
+}
+
+// Returns the position of an expression in the intermediate row.
+func (c *compiler) aggColumn(expr sqlparser.Expr) int {
+	switch v := unparen(expr).(type) {
+	case *sqlparser.FuncExpr:
+		if isAggregate(v) { return len(c.agg.GroupBy)+c.addAggregate(v) }
+	case *sqlparser.ColName:
+		if v.Qualifier.IsEmpty() {
+			if p,ok := c.aliases[v.Name.Lowered()]; ok { return p }
+		}
+		p := c.inputPos(v)
+		for g,q := range c.agg.GroupBy { if p==q { return g } }
+		panic("column must appear in group by or be used in an aggregate: "+v.Name.String())
+	}
+	panic("invalid expression in aggregation: << "+sqlparser.String(expr)+" >>")
+}
+
+// Reports, whether an expression is a column of the intermediate row.
+func (c *compiler) isAggColumn(expr sqlparser.Expr) bool {
+	switch v := unparen(expr).(type) {
+	case *sqlparser.FuncExpr: return isAggregate(v)
+	case *sqlparser.ColName: return true
+	}
+	return false
+}
+
+func (c *compiler) compileAgg(s *sqlparser.Select) {
+	c.agg = new(Aggregation)
+	c.aliases = make(map[string]int)
+	c.exprAliases = make(map[string]int)
+	for _,g := range s.GroupBy {
+		c.agg.GroupBy = append(c.agg.GroupBy,c.inputPos(g))
+	}
+	
+	// SELECT DISTINCT groups by the selected columns.
+	if s.Distinct!="" && len(s.GroupBy)==0 {
+		if hasAggregates(s.SelectExprs) { panic("unsupported: distinct with aggregates") }
+		for _,se := range s.SelectExprs {
+			c.appendCols(se)
+		}
+		if c.isComputed { panic("unsupported: distinct with expressions") }
+		pos := c.output
+		if c.srcs==nil {
+			pos = nil
+			for p := range c.cols { pos = append(pos,p) }
+		}
+		c.output = nil
+		for g,p := range pos {
+			c.agg.GroupBy = append(c.agg.GroupBy,p)
+			c.agg.Output = append(c.agg.Output,g)
+		}
+	} else {
+		for _,se := range s.SelectExprs {
+			ae,ok := se.(*sqlparser.AliasedExpr)
+			if !ok { panic("invalid select expression in aggregation: << "+sqlparser.String(se)+" >>") }
+			c.names = append(c.names,colName(ae))
+			if !c.isAggColumn(ae.Expr) {
+				c.having = true
+				c.agg.Exprs = append(c.agg.Exprs,c.expr(ae.Expr))
+				c.having = false
+				if !ae.As.IsEmpty() { c.exprAliases[ae.As.Lowered()] = len(c.agg.Output) }
+				c.agg.Output = append(c.agg.Output,-1)
+				c.isComputed = true
+				continue
+			}
+			p := c.aggColumn(ae.Expr)
+			c.agg.Output = append(c.agg.Output,p)
+			c.agg.Exprs = append(c.agg.Exprs,&table.Expression{Op:table.E_COLUMN,Index:p})
+			if !ae.As.IsEmpty() { c.aliases[ae.As.Lowered()] = p }
+		}
+	}
+	if !c.isComputed { c.agg.Exprs = nil }
+	
+	c.having = true
+	if s.Having!=nil { c.agg.Having = c.predicate(s.Having.Expr) }
+	for _,o := range s.OrderBy {
+		if _,ok := c.computedAlias(o.Expr); ok { c.agg.OrderResult = true }
+	}
+	for _,o := range s.OrderBy {
+		p := 0
+		if c.agg.OrderResult { p = c.resultPos(o.Expr) } else { p = c.aggColumn(o.Expr) }
+		c.agg.Order = append(c.agg.Order,table.ColumnOrder{Index:p,Desc:o.Direction==sqlparser.DescScr})
+	}
+	c.having = false
+}
+
+// Returns the position of the computed result column, 'expr' is the alias of.
+func (c *compiler) computedAlias(expr sqlparser.Expr) (int,bool) {
+	v,ok := unparen(expr).(*sqlparser.ColName)
+	if !ok || !v.Qualifier.IsEmpty() { return 0,false }
+	i,ok := c.exprAliases[v.Name.Lowered()]
+	return i,ok
+}
+
+// Returns the position of an expression in the result row.
+func (c *compiler) resultPos(expr sqlparser.Expr) int {
+	if i,ok := c.computedAlias(expr); ok { return i }
+	p := c.aggColumn(expr)
+	for i,q := range c.agg.Output { if p==q { return i } }
+	panic("unsupported: order by << "+sqlparser.String(expr)+" >>, which is not selected, along with a computed column")
+}
@@ -0,0 +1,519 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/mad-day/db-utils/table/util"
+import "fmt"
+import "math"
+import "math/rand"
+import "strconv"
+import "strings"
+import "time"
+import "unicode/utf8"
+
+/*
+The built-in functions. They follow MySQL, see
+https://dev.mysql.com/doc/refman/8.0/en/functions.html
+*/
+
+func argString(v interface{}) (string,error) {
+	s,err := util.Convert(v,"char")
+	if err!=nil { return "",err }
+	return s.(string),nil
+}
+func argInt(v interface{}) (int64,error) {
+	if f,ok := v.(float64); ok { return int64(math.Round(f)),nil }
+	n,err := util.Convert(v,"signed")
+	if err!=nil { return 0,err }
+	return n.(int64),nil
+}
+func argFloat(v interface{}) (float64,error) {
+	f,err := util.Convert(v,"decimal")
+	if err!=nil { return 0,err }
+	return f.(float64),nil
+}
+// Returns the numeric value of 'v', preferring integers.
+func argNumber(v interface{}) (n int64,f float64,isInt bool,err error) {
+	switch x := v.(type) {
+	case int64: return x,float64(x),true,nil
+	case bool:
+		if x { return 1,1,true,nil }
+		return 0,0,true,nil
+	case string,[]byte:
+		s,_ := argString(v)
+		if n,err = strconv.ParseInt(strings.TrimSpace(s),10,64); err==nil { return n,float64(n),true,nil }
+	}
+	f,err = argFloat(v)
+	return
+}
+func argTime(v interface{}) (time.Time,error) {
+	t,err := util.Convert(v,"datetime")
+	if err!=nil { t,err = util.Convert(v,"date") }
+	if err!=nil { return time.Time{},fmt.Errorf("invalid date: %v",v) }
+	return t.(time.Time),nil
+}
+
+func now() time.Time { return time.Now().UTC().Truncate(time.Second) }
+
+func bool2int(b bool) interface{} {
+	if b { return int64(1) }
+	return int64(0)
+}
+
+func register(names string,f *Function) {
+	for _,n := range strings.Split(names,",") { RegisterFunction(n,f) }
+}
+
+// Functions of one string argument.
+func stringFunc(names string,f func(s string) interface{}) {
+	register(names,&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+		s,err := argString(args[0])
+		if err!=nil { return nil,err }
+		return f(s),nil
+	}})
+}
+
+// Functions of one numeric argument.
+func floatFunc(names string,f func(x float64) float64) {
+	register(names,&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+		x,err := argFloat(args[0])
+		if err!=nil { return nil,err }
+		r := f(x)
+		if math.IsNaN(r) || math.IsInf(r,0) { return nil,nil }
+		return r,nil
+	}})
+}
+
+// Functions of one date argument.
+func timeFunc(names string,f func(t time.Time) interface{}) {
+	register(names,&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+		t,err := argTime(args[0])
+		if err!=nil { return nil,err }
+		return f(t),nil
+	}})
+}
+
+// Functions without arguments, that return the current time.
+func clockFunc(names string,f func(t time.Time) interface{}) {
+	register(names,&Function{MaxArgs:1,Volatile:true,Call:func(args []interface{}) (interface{},error) {
+		return f(now()),nil
+	}})
+}
+
+// The MySQL position 'pos' (1-based, or from the end, if negative) in 'r'.
+func strPos(r []rune,pos int64) int {
+	switch {
+	case pos>0: pos--
+	case pos<0: pos += int64(len(r))
+	default: return len(r)
+	}
+	if pos<0 || pos>int64(len(r)) { return len(r) }
+	return int(pos)
+}
+
+func substring(args []interface{}) (interface{},error) {
+	s,err := argString(args[0])
+	if err!=nil { return nil,err }
+	pos,err := argInt(args[1])
+	if err!=nil { return nil,err }
+	r := []rune(s)
+	i := strPos(r,pos)
+	j := len(r)
+	if len(args)>2 {
+		n,err := argInt(args[2])
+		if err!=nil { return nil,err }
+		if n<=0 { return "",nil }
+		if int64(j-i)>n { j = i+int(n) }
+	}
+	return string(r[i:j]),nil
+}
+
+func leftRight(right bool) table.ScalarFunc {
+	return func(args []interface{}) (interface{},error) {
+		s,err := argString(args[0])
+		if err!=nil { return nil,err }
+		n,err := argInt(args[1])
+		if err!=nil { return nil,err }
+		r := []rune(s)
+		if n<0 { n = 0 }
+		if n>int64(len(r)) { n = int64(len(r)) }
+		if right { return string(r[len(r)-int(n):]),nil }
+		return string(r[:n]),nil
+	}
+}
+
+/*
+The maximum length of a string result in bytes, MySQL's default of
+max_allowed_packet. Longer results are NULL, as in MySQL.
+*/
+const maxStringLength = 64<<20
+
+// Reports, whether 'n' times 'size' bytes are within maxStringLength.
+func fits(n,size int64) bool { return size==0 || n<=maxStringLength/size }
+
+func pad(right bool) table.ScalarFunc {
+	return func(args []interface{}) (interface{},error) {
+		s,err := argString(args[0])
+		if err!=nil { return nil,err }
+		n,err := argInt(args[1])
+		if err!=nil { return nil,err }
+		p,err := argString(args[2])
+		if err!=nil { return nil,err }
+		r := []rune(s)
+		if n<0 || n>maxStringLength { return nil,nil }
+		if n<=int64(len(r)) { return string(r[:n]),nil }
+		pr := []rune(p)
+		if len(pr)==0 { return nil,nil }
+		full,rest := (int(n)-len(r))/len(pr),(int(n)-len(r))%len(pr)
+		fill := string(pr[:rest])
+		if int64(len(s))+int64(full)*int64(len(p))+int64(len(fill))>maxStringLength { return nil,nil }
+		fill = strings.Repeat(p,full)+fill
+		if right { return s+fill,nil }
+		return fill+s,nil
+	}
+}
+
+// LOCATE(substr,str[,pos]) and INSTR(str,substr).
+func locate(args []interface{}) (interface{},error) {
+	sub,err := argString(args[0])
+	if err!=nil { return nil,err }
+	s,err := argString(args[1])
+	if err!=nil { return nil,err }
+	start := int64(1)
+	if len(args)>2 {
+		if start,err = argInt(args[2]); err!=nil { return nil,err }
+		if start<1 { return int64(0),nil }
+	}
+	r := []rune(s)
+	if start>int64(len(r))+1 { return int64(0),nil }
+	i := strings.Index(string(r[start-1:]),sub)
+	if i<0 { return int64(0),nil }
+	return start+int64(utf8.RuneCountInString(string(r[start-1:])[:i])),nil
+}
+
+func trim(f func(string,string) string) func(string) interface{} {
+	return func(s string) interface{} { return f(s," ") }
+}
+
+func pick(greatest bool) table.ScalarFunc {
+	return func(args []interface{}) (interface{},error) {
+		r := args[0]
+		for _,a := range args[1:] {
+			c,err := util.Compare(a,r)
+			if err!=nil { return nil,err }
+			if (c>0)==greatest && c!=0 { r = a }
+		}
+		return r,nil
+	}
+}
+
+// ROUND(x[,d]) and TRUNCATE(x,d).
+func round(f func(float64) float64) table.ScalarFunc {
+	return func(args []interface{}) (interface{},error) {
+		n,x,isInt,err := argNumber(args[0])
+		if err!=nil { return nil,err }
+		var d int64
+		if len(args)>1 {
+			if d,err = argInt(args[1]); err!=nil { return nil,err }
+		}
+		if isInt && d>=0 { return n,nil }
+		p := math.Pow(10,float64(d))
+		r := f(x*p)/p
+		if isInt { return int64(r),nil }
+		return r,nil
+	}
+}
+
+var monthNames = [...]string{"January","February","March","April","May","June","July","August","September","October","November","December"}
+var dayNames = [...]string{"Sunday","Monday","Tuesday","Wednesday","Thursday","Friday","Saturday"}
+
+// Formats 't' as DATE_FORMAT() does.
+func dateFormat(t time.Time,f string) string {
+	var b strings.Builder
+	for i := 0; i<len(f); i++ {
+		if f[i]!='%' || i+1==len(f) {
+			b.WriteByte(f[i])
+			continue
+		}
+		i++
+		h12 := t.Hour()%12
+		if h12==0 { h12 = 12 }
+		switch f[i] {
+		case 'Y': fmt.Fprintf(&b,"%04d",t.Year())
+		case 'y': fmt.Fprintf(&b,"%02d",t.Year()%100)
+		case 'm': fmt.Fprintf(&b,"%02d",int(t.Month()))
+		case 'c': fmt.Fprintf(&b,"%d",int(t.Month()))
+		case 'M': b.WriteString(monthNames[t.Month()-1])
+		case 'b': b.WriteString(monthNames[t.Month()-1][:3])
+		case 'd': fmt.Fprintf(&b,"%02d",t.Day())
+		case 'e': fmt.Fprintf(&b,"%d",t.Day())
+		case 'j': fmt.Fprintf(&b,"%03d",t.YearDay())
+		case 'W': b.WriteString(dayNames[t.Weekday()])
+		case 'a': b.WriteString(dayNames[t.Weekday()][:3])
+		case 'w': fmt.Fprintf(&b,"%d",int(t.Weekday()))
+		case 'H': fmt.Fprintf(&b,"%02d",t.Hour())
+		case 'k': fmt.Fprintf(&b,"%d",t.Hour())
+		case 'h','I': fmt.Fprintf(&b,"%02d",h12)
+		case 'l': fmt.Fprintf(&b,"%d",h12)
+		case 'i': fmt.Fprintf(&b,"%02d",t.Minute())
+		case 's','S': fmt.Fprintf(&b,"%02d",t.Second())
+		case 'f': fmt.Fprintf(&b,"%06d",t.Nanosecond()/1000)
+		case 'p': b.WriteString(t.Format("PM"))
+		case 'T': b.WriteString(t.Format("15:04:05"))
+		case 'r': b.WriteString(t.Format("03:04:05 PM"))
+		default: b.WriteByte(f[i])
+		}
+	}
+	return b.String()
+}
+
+func coalesce(args []interface{}) (interface{},error) {
+	for _,a := range args { if a!=nil { return a,nil } }
+	return nil,nil
+}
+
+func init() {
+	// Control flow.
+	register("coalesce",&Function{MinArgs:1,MaxArgs:-1,NullArgs:true,Call:coalesce})
+	register("ifnull",&Function{MinArgs:2,MaxArgs:2,NullArgs:true,Call:coalesce})
+	register("nullif",&Function{MinArgs:2,MaxArgs:2,NullArgs:true,Call:func(args []interface{}) (interface{},error) {
+		if args[0]==nil || args[1]==nil { return args[0],nil }
+		c,err := util.Compare(args[0],args[1])
+		if err!=nil { return nil,err }
+		if c==0 { return nil,nil }
+		return args[0],nil
+	}})
+	register("if",&Function{MinArgs:3,MaxArgs:3,NullArgs:true,Call:func(args []interface{}) (interface{},error) {
+		if args[0]==nil { return args[2],nil }
+		_,f,_,err := argNumber(args[0])
+		if err!=nil { return nil,err }
+		if f!=0 { return args[1],nil }
+		return args[2],nil
+	}})
+	register("isnull",&Function{MinArgs:1,MaxArgs:1,NullArgs:true,Call:func(args []interface{}) (interface{},error) {
+		return bool2int(args[0]==nil),nil
+	}})
+	
+	// Strings.
+	register("concat",&Function{MinArgs:1,MaxArgs:-1,Call:func(args []interface{}) (interface{},error) {
+		var b strings.Builder
+		for _,a := range args {
+			s,err := argString(a)
+			if err!=nil { return nil,err }
+			b.WriteString(s)
+		}
+		return b.String(),nil
+	}})
+	register("concat_ws",&Function{MinArgs:2,MaxArgs:-1,NullArgs:true,Call:func(args []interface{}) (interface{},error) {
+		if args[0]==nil { return nil,nil }
+		sep,err := argString(args[0])
+		if err!=nil { return nil,err }
+		var l []string
+		for _,a := range args[1:] {
+			if a==nil { continue }
+			s,err := argString(a)
+			if err!=nil { return nil,err }
+			l = append(l,s)
+		}
+		return strings.Join(l,sep),nil
+	}})
+	stringFunc("lower,lcase",func(s string) interface{} { return strings.ToLower(s) })
+	stringFunc("upper,ucase",func(s string) interface{} { return strings.ToUpper(s) })
+	stringFunc("length,octet_length",func(s string) interface{} { return int64(len(s)) })
+	stringFunc("char_length,character_length",func(s string) interface{} { return int64(utf8.RuneCountInString(s)) })
+	stringFunc("trim",trim(strings.Trim))
+	stringFunc("ltrim",trim(strings.TrimLeft))
+	stringFunc("rtrim",trim(strings.TrimRight))
+	stringFunc("reverse",func(s string) interface{} {
+		r := []rune(s)
+		for i,j := 0,len(r)-1; i<j; i,j = i+1,j-1 { r[i],r[j] = r[j],r[i] }
+		return string(r)
+	})
+	stringFunc("ascii",func(s string) interface{} {
+		if s=="" { return int64(0) }
+		return int64(s[0])
+	})
+	register("substring,substr,mid",&Function{MinArgs:2,MaxArgs:3,Call:substring})
+	register("left",&Function{MinArgs:2,MaxArgs:2,Call:leftRight(false)})
+	register("right",&Function{MinArgs:2,MaxArgs:2,Call:leftRight(true)})
+	register("lpad",&Function{MinArgs:3,MaxArgs:3,Call:pad(false)})
+	register("rpad",&Function{MinArgs:3,MaxArgs:3,Call:pad(true)})
+	register("locate",&Function{MinArgs:2,MaxArgs:3,Call:locate})
+	register("instr",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		return locate([]interface{}{args[1],args[0]})
+	}})
+	register("replace",&Function{MinArgs:3,MaxArgs:3,Call:func(args []interface{}) (interface{},error) {
+		var s [3]string
+		for i := range s {
+			var err error
+			if s[i],err = argString(args[i]); err!=nil { return nil,err }
+		}
+		if s[1]=="" { return s[0],nil }
+		if d := int64(len(s[2])-len(s[1])); d>0 {
+			k := int64(strings.Count(s[0],s[1]))
+			if !fits(k,d) || int64(len(s[0]))+k*d>maxStringLength { return nil,nil }
+		}
+		return strings.Replace(s[0],s[1],s[2],-1),nil
+	}})
+	register("repeat",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		s,err := argString(args[0])
+		if err!=nil { return nil,err }
+		n,err := argInt(args[1])
+		if err!=nil { return nil,err }
+		if n<=0 { return "",nil }
+		if !fits(n,int64(len(s))) { return nil,nil }
+		return strings.Repeat(s,int(n)),nil
+	}})
+	register("space",&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+		n,err := argInt(args[0])
+		if err!=nil { return nil,err }
+		if n<=0 { return "",nil }
+		if !fits(n,1) { return nil,nil }
+		return strings.Repeat(" ",int(n)),nil
+	}})
+	register("strcmp",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		a,err := argString(args[0])
+		if err!=nil { return nil,err }
+		b,err := argString(args[1])
+		if err!=nil { return nil,err }
+		return int64(strings.Compare(a,b)),nil
+	}})
+	
+	// Numbers.
+	register("abs",&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+		n,f,isInt,err := argNumber(args[0])
+		if err!=nil { return nil,err }
+		if !isInt { return math.Abs(f),nil }
+		if n<0 { n = -n }
+		return n,nil
+	}})
+	register("sign",&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+		_,f,_,err := argNumber(args[0])
+		if err!=nil { return nil,err }
+		switch {
+		case f>0: return int64(1),nil
+		case f<0: return int64(-1),nil
+		}
+		return int64(0),nil
+	}})
+	for _,f := range []struct{ names string; f func(float64) float64 }{ {"ceil,ceiling",math.Ceil},{"floor",math.Floor} } {
+		f := f
+		register(f.names,&Function{MinArgs:1,MaxArgs:1,Call:func(args []interface{}) (interface{},error) {
+			n,x,isInt,err := argNumber(args[0])
+			if err!=nil { return nil,err }
+			if isInt { return n,nil }
+			return int64(f.f(x)),nil
+		}})
+	}
+	register("round",&Function{MinArgs:1,MaxArgs:2,Call:round(math.Round)})
+	register("truncate",&Function{MinArgs:2,MaxArgs:2,Call:round(math.Trunc)})
+	register("mod",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		var m util.Matcher
+		return m.Eval(&table.Expression{Op:table.E_BINARY,Operator:"%",Args:[]*table.Expression{
+			{Op:table.E_VALUE,Value:args[0]},{Op:table.E_VALUE,Value:args[1]},
+		}},nil,nil)
+	}})
+	register("pow,power",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		x,err := argFloat(args[0])
+		if err!=nil { return nil,err }
+		y,err := argFloat(args[1])
+		if err!=nil { return nil,err }
+		return math.Pow(x,y),nil
+	}})
+	floatFunc("sqrt",math.Sqrt)
+	floatFunc("exp",math.Exp)
+	floatFunc("ln",math.Log)
+	floatFunc("log2",math.Log2)
+	floatFunc("log10",math.Log10)
+	register("log",&Function{MinArgs:1,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		x,err := argFloat(args[len(args)-1])
+		if err!=nil { return nil,err }
+		r := math.Log(x)
+		if len(args)==2 {
+			b,err := argFloat(args[0])
+			if err!=nil { return nil,err }
+			r /= math.Log(b)
+		}
+		if math.IsNaN(r) || math.IsInf(r,0) { return nil,nil }
+		return r,nil
+	}})
+	register("pi",&Function{Call:func(args []interface{}) (interface{},error) { return math.Pi,nil }})
+	register("greatest",&Function{MinArgs:2,MaxArgs:-1,Call:pick(true)})
+	register("least",&Function{MinArgs:2,MaxArgs:-1,Call:pick(false)})
+	register("rand",&Function{MaxArgs:1,Volatile:true,NullArgs:true,Call:func(args []interface{}) (interface{},error) {
+		if len(args)==0 || args[0]==nil { return rand.Float64(),nil }
+		seed,err := argInt(args[0])
+		if err!=nil { return nil,err }
+		return rand.New(rand.NewSource(seed)).Float64(),nil
+	}})
+	
+	// Dates and times. The current time is in UTC.
+	clockFunc("now,current_timestamp,localtime,localtimestamp,sysdate,utc_timestamp",func(t time.Time) interface{} { return t })
+	clockFunc("curdate,current_date,utc_date",func(t time.Time) interface{} { return t.Truncate(24*time.Hour) })
+	clockFunc("curtime,current_time,utc_time",func(t time.Time) interface{} { return t.Format("15:04:05") })
+	register("unix_timestamp",&Function{MaxArgs:1,Volatile:true,Call:func(args []interface{}) (interface{},error) {
+		if len(args)==0 { return now().Unix(),nil }
+		t,err := argTime(args[0])
+		if err!=nil { return nil,err }
+		return t.Unix(),nil
+	}})
+	register("from_unixtime",&Function{MinArgs:1,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		n,err := argInt(args[0])
+		if err!=nil { return nil,err }
+		t := time.Unix(n,0).UTC()
+		if len(args)==1 { return t,nil }
+		f,err := argString(args[1])
+		if err!=nil { return nil,err }
+		return dateFormat(t,f),nil
+	}})
+	register("date_format",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		t,err := argTime(args[0])
+		if err!=nil { return nil,err }
+		f,err := argString(args[1])
+		if err!=nil { return nil,err }
+		return dateFormat(t,f),nil
+	}})
+	register("datediff",&Function{MinArgs:2,MaxArgs:2,Call:func(args []interface{}) (interface{},error) {
+		a,err := argTime(args[0])
+		if err!=nil { return nil,err }
+		b,err := argTime(args[1])
+		if err!=nil { return nil,err }
+		day := func(t time.Time) int64 { return time.Date(t.Year(),t.Month(),t.Day(),0,0,0,0,time.UTC).Unix()/86400 }
+		return day(a)-day(b),nil
+	}})
+	timeFunc("date",func(t time.Time) interface{} { return time.Date(t.Year(),t.Month(),t.Day(),0,0,0,0,t.Location()) })
+	timeFunc("year",func(t time.Time) interface{} { return int64(t.Year()) })
+	timeFunc("quarter",func(t time.Time) interface{} { return int64(t.Month()+2)/3 })
+	timeFunc("month",func(t time.Time) interface{} { return int64(t.Month()) })
+	timeFunc("day,dayofmonth",func(t time.Time) interface{} { return int64(t.Day()) })
+	timeFunc("hour",func(t time.Time) interface{} { return int64(t.Hour()) })
+	timeFunc("minute",func(t time.Time) interface{} { return int64(t.Minute()) })
+	timeFunc("second",func(t time.Time) interface{} { return int64(t.Second()) })
+	timeFunc("dayofweek",func(t time.Time) interface{} { return int64(t.Weekday())+1 })
+	timeFunc("weekday",func(t time.Time) interface{} { return (int64(t.Weekday())+6)%7 })
+	timeFunc("dayofyear",func(t time.Time) interface{} { return int64(t.YearDay()) })
+	timeFunc("monthname",func(t time.Time) interface{} { return monthNames[t.Month()-1] })
+	timeFunc("dayname",func(t time.Time) interface{} { return dayNames[t.Weekday()] })
+}
@@ -0,0 +1,254 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/mad-day/db-utils/table/util"
+import "github.com/xwb1989/sqlparser"
+import "io"
+import "sort"
+import "strings"
+import "sync"
+import "sync/atomic"
+
+// The qualifier of the virtual, read-only catalog tables.
+const InformationSchema = "information_schema"
+
+/*
+The catalog tables, built from Schema.Tables at scan time:
+
+	information_schema.tables   table_schema, table_name, table_type
+	information_schema.columns  table_schema, table_name, column_name,
+	                            ordinal_position, data_type, is_nullable,
+	                            extra
+
+They list the tables of the schema and of every schema of its catalog.
+data_type and is_nullable are NULL, unless the table implements
+table.TypedTable.
+*/
+var catalogTables = map[string]func(s *Schema) *catalogTable {
+	"tables": func(s *Schema) *catalogTable {
+		return &catalogTable{s,"tables",
+			[]string{"table_schema","table_name","table_type"},
+			[]table.ColumnType{util.VT_STRING.ColumnType(false),util.VT_STRING.ColumnType(false),util.VT_STRING.ColumnType(false)},
+			(*Schema).catalogTablesRows}
+	},
+	"columns": func(s *Schema) *catalogTable {
+		return &catalogTable{s,"columns",
+			[]string{"table_schema","table_name","column_name","ordinal_position","data_type","is_nullable","extra"},
+			[]table.ColumnType{
+				util.VT_STRING.ColumnType(false),util.VT_STRING.ColumnType(false),util.VT_STRING.ColumnType(false),util.VT_INT.ColumnType(false),
+				util.VT_STRING.ColumnType(true),util.VT_STRING.ColumnType(true),util.VT_STRING.ColumnType(false),
+			},
+			(*Schema).catalogColumnsRows}
+	},
+}
+
+func (s *Schema) tableNames() []string {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	names := make([]string,0,len(s.Tables))
+	for n := range s.Tables { names = append(names,n) }
+	sort.Strings(names)
+	return names
+}
+func (s *Schema) catalogTablesRows() (rows [][]interface{}) {
+	for _,sch := range s.schemas() {
+		for _,n := range sch.tableNames() {
+			rows = append(rows,[]interface{}{sch.Name,n,"BASE TABLE"})
+		}
+	}
+	return
+}
+func (s *Schema) catalogColumnsRows() (rows [][]interface{}) {
+	for _,sch := range s.schemas() { rows = sch.appendColumnsRows(rows) }
+	return
+}
+func (s *Schema) appendColumnsRows(rows [][]interface{}) [][]interface{} {
+	for _,n := range s.tableNames() {
+		tab := s.Get(n)
+		if tab==nil { continue }
+		var types []table.ColumnType
+		if tt,ok := tab.(table.TypedTable); ok { types = tt.ColumnTypes() }
+		autoInc := -1
+		if at,ok := tab.(table.AutoIncrementTable); ok { autoInc = at.AutoIncrementColumn() }
+		for i,c := range tab.Columns() {
+			var dataType,nullable interface{}
+			if i<len(types) {
+				if types[i].DatabaseTypeName!="" { dataType = strings.ToLower(types[i].DatabaseTypeName) }
+				if types[i].NullableKnown {
+					nullable = "NO"
+					if types[i].Nullable { nullable = "YES" }
+				}
+			}
+			extra := ""
+			if i==autoInc { extra = "auto_increment" }
+			rows = append(rows,[]interface{}{s.Name,n,c,int64(i+1),dataType,nullable,extra})
+		}
+	}
+	return rows
+}
+
+/*
+A virtual, read-only table. It accepts no filters or orderings, those are
+evaluated over the returned rows.
+*/
+type catalogTable struct {
+	s *Schema
+	name string
+	cols []string
+	types []table.ColumnType
+	rows func(s *Schema) [][]interface{}
+}
+func (c *catalogTable) Columns() []string { return c.cols }
+func (c *catalogTable) ColumnTypes() []table.ColumnType { return c.types }
+func (c *catalogTable) ScanCaps() []table.ColumnCaps { return make([]table.ColumnCaps,len(c.cols)) }
+func (c *catalogTable) ExplainScan(meta *table.TableScan) string { return "full scan" }
+func (c *catalogTable) TableScan(cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	if len(meta.Filter)!=0 { return nil,table.ScanError{ErrCode:table.E_FILTER_FIELD_UNSUPP,FieldIndex:meta.Filter[0].Index} }
+	if len(meta.Order)!=0 { return nil,table.ScanError{ErrCode:table.E_ORDERBY_FIELD,FieldIndex:meta.Order[0].Index} }
+	return &catalogIterator{c.rows(c.s)},nil
+}
+
+type catalogIterator struct {
+	rows [][]interface{}
+}
+func (c *catalogIterator) Close() error { return nil }
+func (c *catalogIterator) Next(cols []int,vals []interface{}) error {
+	if len(c.rows)==0 { return io.EOF }
+	for i,j := range cols { vals[i] = c.rows[0][j] }
+	c.rows = c.rows[1:]
+	return nil
+}
+
+/*
+Resolves a table name. Names qualified with InformationSchema refer to the
+catalog tables, other qualifiers to a schema (see Resolve()).
+*/
+func (s *Schema) GetQualified(tn sqlparser.TableName) table.Table {
+	q := tn.Qualifier.String()
+	switch {
+	case q=="": return s.Get(tn.Name.String())
+	case strings.EqualFold(q,InformationSchema):
+		f,ok := catalogTables[strings.ToLower(tn.Name.String())]
+		if !ok { return nil }
+		return f(s)
+	}
+	return s.Resolve(q).Get(tn.Name.String())
+}
+
+/*
+Returns the name of a table of the schema, or of a catalog table. Tables of
+other schemas of the catalog are qualified with the schema name.
+*/
+func (s *Schema) NameOf(tab table.Table) (string,bool) {
+	if c,ok := tab.(*catalogTable); ok { return InformationSchema+"."+c.name,true }
+	for _,sch := range s.schemas() {
+		if n,ok := sch.nameOf(tab); ok {
+			if sch!=s { n = sch.Name+"."+n }
+			return n,true
+		}
+	}
+	return "",false
+}
+func (s *Schema) nameOf(tab table.Table) (string,bool) {
+	s.mu.RLock(); defer s.mu.RUnlock()
+	for n,t := range s.Tables {
+		if t==tab { return n,true }
+	}
+	return "",false
+}
+
+/*
+A set of named schemas. A table name qualified with a schema name, as in
+"db1.users", refers to a table of the catalog, see Schema.GetQualified().
+*/
+type Catalog struct {
+	Schemas map[string]*Schema
+	
+	version uint64
+	mu sync.RWMutex
+}
+
+// Adds the schema 'n' to the catalog, and sets its Name and Catalog.
+func (c *Catalog) Put(n string,s *Schema) {
+	n = strings.ToLower(n)
+	c.mu.Lock(); defer c.mu.Unlock()
+	if c.Schemas==nil { c.Schemas = make(map[string]*Schema) }
+	if o := c.Schemas[n]; o!=nil { atomic.AddUint64(&c.version,o.Version()+1) }
+	s.Name,s.Catalog = n,c
+	c.Schemas[n] = s
+	atomic.AddUint64(&c.version,1)
+}
+func (c *Catalog) Delete(n string) {
+	n = strings.ToLower(n)
+	c.mu.Lock(); defer c.mu.Unlock()
+	o := c.Schemas[n]
+	if o==nil { return }
+	delete(c.Schemas,n)
+	
+	// Keep Version() from decreasing.
+	atomic.AddUint64(&c.version,o.Version()+1)
+}
+func (c *Catalog) Get(n string) *Schema {
+	if c==nil { return nil }
+	c.mu.RLock(); defer c.mu.RUnlock()
+	return c.Schemas[strings.ToLower(n)]
+}
+
+// Returns a counter, that changes whenever a schema, or a table of one of the schemas, is put or deleted.
+func (c *Catalog) Version() uint64 {
+	if c==nil { return 0 }
+	c.mu.RLock(); defer c.mu.RUnlock()
+	v := atomic.LoadUint64(&c.version)
+	for _,s := range c.Schemas { v += s.Version() }
+	return v
+}
+func (c *Catalog) names() []string {
+	c.mu.RLock(); defer c.mu.RUnlock()
+	names := make([]string,0,len(c.Schemas))
+	for n := range c.Schemas { names = append(names,n) }
+	sort.Strings(names)
+	return names
+}
+
+// Returns the schema 'name': Either 's' itself, or a schema of its catalog.
+func (s *Schema) Resolve(name string) *Schema {
+	if strings.EqualFold(name,s.Name) { return s }
+	return s.Catalog.Get(name)
+}
+
+/*
+Returns the schemas, the catalog tables list: 's', unless it is part of its
+catalog, followed by the schemas of the catalog.
+*/
+func (s *Schema) schemas() []*Schema {
+	var r []*Schema
+	if s.Catalog.Get(s.Name)!=s { r = append(r,s) }
+	if s.Catalog!=nil {
+		for _,n := range s.Catalog.names() {
+			if cs := s.Catalog.Get(n); cs!=nil { r = append(r,cs) }
+		}
+	}
+	return r
+}
@@ -0,0 +1,204 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/xwb1989/sqlparser"
+import "strings"
+import "strconv"
+import "fmt"
+
+// sqlparser's colKeyPrimary, which is unexported.
+const colKeyPrimary sqlparser.ColumnKeyOption = 1
+
+var ErrNoFactory = fmt.Errorf("schema has no table factory")
+
+// A column of a CREATE TABLE statement.
+type ColumnDef struct {
+	Name string
+
+	// The SQL type name in lower case, such as "bigint" or "varchar".
+	Type string
+
+	// The length (or precision), if specified, otherwise 0.
+	Length int
+
+	Unsigned bool
+	NotNull bool
+	AutoIncrement bool
+}
+
+// The definition of a table, as given by a CREATE TABLE statement.
+type TableDef struct {
+	// The table name in lower case.
+	Name string
+	Columns []ColumnDef
+
+	// The indices into Columns, that form the primary key, if any.
+	PrimaryKey []int
+}
+
+/*
+Creates and drops the tables of a Schema. A backend registers its factory
+as Schema.Factory, in order to support CREATE TABLE, DROP TABLE and
+TRUNCATE.
+
+The Schema itself keeps track of the table names: CreateTable() is never
+called for an existing table, DropTable() and TruncateTable() never for a
+missing one.
+*/
+type TableFactory interface {
+	CreateTable(def *TableDef) (table.Table,error)
+	DropTable(name string,tab table.Table) error
+
+	// Deletes every row of the table.
+	TruncateTable(name string,tab table.Table) error
+}
+
+// A compiled DDL statement. See Schema.CompileDDL().
+type DDL struct {
+	// One of sqlparser.CreateStr, sqlparser.DropStr or sqlparser.TruncateStr.
+	Action string
+
+	// The table name in lower case.
+	Name string
+	IfExists bool
+	
+	// CREATE TABLE IF NOT EXISTS. The parser drops this clause, see CreateIfNotExists().
+	IfNotExists bool
+	
+	// The schema name of a qualified table name, in lower case.
+	Schema string
+
+	// Set for sqlparser.CreateStr.
+	Def *TableDef
+}
+
+func compileTableDef(name string,spec *sqlparser.TableSpec) (*TableDef,error) {
+	def := &TableDef{Name:name}
+	cm := make(map[string]int)
+	for _,col := range spec.Columns {
+		cd := ColumnDef{
+			Name: col.Name.String(),
+			Type: strings.ToLower(col.Type.Type),
+			Unsigned: bool(col.Type.Unsigned),
+			NotNull: bool(col.Type.NotNull),
+			AutoIncrement: bool(col.Type.Autoincrement),
+		}
+		if col.Type.Length!=nil {
+			n,err := strconv.Atoi(string(col.Type.Length.Val))
+			if err!=nil { return nil,fmt.Errorf("column %s: invalid length: %v",cd.Name,err) }
+			cd.Length = n
+		}
+		ln := strings.ToLower(cd.Name)
+		if _,ok := cm[ln]; ok { return nil,fmt.Errorf("duplicate column: %s",cd.Name) }
+		cm[ln] = len(def.Columns)
+		if col.Type.KeyOpt==colKeyPrimary { def.PrimaryKey = append(def.PrimaryKey,len(def.Columns)) }
+		def.Columns = append(def.Columns,cd)
+	}
+	for _,idx := range spec.Indexes {
+		if !idx.Info.Primary { return nil,fmt.Errorf("unsupported: index %s",idx.Info.Name.String()) }
+		if len(def.PrimaryKey)!=0 { return nil,fmt.Errorf("multiple primary keys defined") }
+		for _,ic := range idx.Columns {
+			i,ok := cm[ic.Column.Lowered()]
+			if !ok { return nil,fmt.Errorf("primary key: column not found: %s",ic.Column.String()) }
+			def.PrimaryKey = append(def.PrimaryKey,i)
+		}
+	}
+	if len(def.PrimaryKey)>1 && len(spec.Indexes)==0 { return nil,fmt.Errorf("multiple primary keys defined") }
+	return def,nil
+}
+
+/*
+Reports, whether the query is a CREATE TABLE IF NOT EXISTS statement. The
+sqlparser grammar accepts, but discards the IF NOT EXISTS clause, so the
+caller has to set DDL.IfNotExists using the query text.
+*/
+func CreateIfNotExists(query string) bool {
+	tkn := sqlparser.NewStringTokenizer(query)
+	for _,want := range []int{sqlparser.CREATE,sqlparser.TABLE,sqlparser.IF,sqlparser.NOT,sqlparser.EXISTS} {
+		typ,_ := tkn.Scan()
+		for typ==sqlparser.COMMENT { typ,_ = tkn.Scan() }
+		if typ!=want { return false }
+	}
+	return true
+}
+
+// Compiles a CREATE TABLE, DROP TABLE or TRUNCATE statement.
+func (s *Schema) CompileDDL(stmt *sqlparser.DDL) (*DDL,error) {
+	d := &DDL{Action:stmt.Action,IfExists:stmt.IfExists}
+	switch stmt.Action {
+	case sqlparser.CreateStr:
+		if stmt.TableSpec==nil { return nil,fmt.Errorf("unsupported: create %s",sqlparser.String(stmt.NewName)) }
+		d.Name = strings.ToLower(stmt.NewName.Name.String())
+		d.Schema = strings.ToLower(stmt.NewName.Qualifier.String())
+		def,err := compileTableDef(d.Name,stmt.TableSpec)
+		if err!=nil { return nil,err }
+		d.Def = def
+	case sqlparser.DropStr,sqlparser.TruncateStr:
+		d.Name = strings.ToLower(stmt.Table.Name.String())
+		d.Schema = strings.ToLower(stmt.Table.Qualifier.String())
+	default: return nil,fmt.Errorf("unsupported: %s",sqlparser.String(stmt))
+	}
+	return d,nil
+}
+
+/*
+Executes a compiled DDL statement using Schema.Factory. If the table name
+is qualified, the statement is executed on that schema instead. The schema is
+locked during the statement, so that concurrent statements on the same table
+see each other's effects.
+*/
+func (s *Schema) ExecDDL(d *DDL) error {
+	if d.Schema!="" {
+		ts := s.Resolve(d.Schema)
+		if ts==nil { return fmt.Errorf("unknown schema: %s",d.Schema) }
+		s = ts
+	}
+	if s.Factory==nil { return ErrNoFactory }
+	s.mu.Lock(); defer s.mu.Unlock()
+	tab := s.Tables[d.Name]
+	switch d.Action {
+	case sqlparser.CreateStr:
+		if tab!=nil {
+			if d.IfNotExists { return nil }
+			return fmt.Errorf("table already exists: %s",d.Name)
+		}
+		tab,err := s.Factory.CreateTable(d.Def)
+		if err!=nil { return err }
+		s.put(d.Name,tab)
+	case sqlparser.DropStr:
+		if tab==nil {
+			if d.IfExists { return nil }
+			return fmt.Errorf("table not found: %s",d.Name)
+		}
+		if err := s.Factory.DropTable(d.Name,tab); err!=nil { return err }
+		s.delete(d.Name)
+	case sqlparser.TruncateStr:
+		if tab==nil { return fmt.Errorf("table not found: %s",d.Name) }
+		return s.Factory.TruncateTable(d.Name,tab)
+	default: return fmt.Errorf("unsupported: %s",d.Action)
+	}
+	return nil
+}
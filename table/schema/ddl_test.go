@@ -0,0 +1,117 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package schema_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/schema"
+	"github.com/xwb1989/sqlparser"
+)
+
+type stubTable []string
+
+func (t stubTable) Columns() []string { return t }
+func (t stubTable) TableScan(cols []int, meta *table.TableScan) (table.TableIterator, error) {
+	return nil, table.ErrPredicateUnsupp
+}
+
+type stubFactory struct{}
+
+func (stubFactory) CreateTable(def *schema.TableDef) (table.Table, error) {
+	var t stubTable
+	for _, c := range def.Columns {
+		t = append(t, c.Name)
+	}
+	return t, nil
+}
+func (stubFactory) DropTable(name string, tab table.Table) error     { return nil }
+func (stubFactory) TruncateTable(name string, tab table.Table) error { return nil }
+
+func execDDL(s *schema.Schema, query string) error {
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return err
+	}
+	d, err := s.CompileDDL(stmt.(*sqlparser.DDL))
+	if err != nil {
+		return err
+	}
+	return s.ExecDDL(d)
+}
+
+func TestConcurrentDDL(t *testing.T) {
+	s := &schema.Schema{Factory: stubFactory{}}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- execDDL(s, "create table t (id bigint)")
+			s.Get("t")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("table created %d times", created)
+	}
+	if s.Get("t") == nil {
+		t.Error("table not found")
+	}
+}
+
+func TestCreateIfNotExists(t *testing.T) {
+	s := &schema.Schema{Factory: stubFactory{}}
+	for _, query := range []string{
+		"create table if not exists t (id bigint)",
+		"/* again */ CREATE TABLE If Not Exists t (id bigint, name varchar(20))",
+	} {
+		stmt, err := sqlparser.Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := s.CompileDDL(stmt.(*sqlparser.DDL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.IfNotExists = schema.CreateIfNotExists(query)
+		if err := s.ExecDDL(d); err != nil {
+			t.Errorf("%s: %v", query, err)
+		}
+	}
+	if cols := s.Get("t").Columns(); len(cols) != 1 {
+		t.Errorf("table replaced: %v", cols)
+	}
+	if err := execDDL(s, "create table t (id bigint)"); err == nil {
+		t.Error("existing table created again")
+	}
+}
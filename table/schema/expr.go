@@ -0,0 +1,161 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/mad-day/db-utils/table/util"
+import "github.com/xwb1989/sqlparser"
+import "strings"
+
+func isConst(e *table.Expression) bool {
+	if e==nil { return true }
+	if e.Op!=table.E_VALUE { return false }
+	_,ph := e.Value.(PlaceHolder)
+	return !ph
+}
+
+// Evaluates an expression at compile time, if its arguments are constant.
+func fold(e *table.Expression) *table.Expression {
+	if _,ph := e.Value.(PlaceHolder); ph { return e }
+	for _,a := range e.Args {
+		if !isConst(a) { return e }
+	}
+	var m util.Matcher
+	v,err := m.Eval(e,nil,nil)
+	if err!=nil { panic(err) }
+	return &table.Expression{Op:table.E_VALUE,Value:v}
+}
+func mkExpr(op table.ExprOp,operator string,args ...*table.Expression) *table.Expression {
+	return fold(&table.Expression{Op:op,Operator:operator,Args:args})
+}
+
+var binaryOps = map[string]string{
+	sqlparser.BitAndStr:     "&",
+	sqlparser.BitOrStr:      "|",
+	sqlparser.BitXorStr:     "^",
+	sqlparser.PlusStr:       "+",
+	sqlparser.MinusStr:      "-",
+	sqlparser.MultStr:       "*",
+	sqlparser.DivStr:        "/",
+	sqlparser.IntDivStr:     "div",
+	sqlparser.ModStr:        "%",
+	sqlparser.ShiftLeftStr:  "<<",
+	sqlparser.ShiftRightStr: ">>",
+}
+
+/*
+Compiles a scalar expression. Columns resolve as in column(), and constant
+subexpressions are evaluated right away.
+*/
+func (c *compiler) expr(expr sqlparser.Expr) *table.Expression {
+	switch v := expr.(type) {
+	case *sqlparser.ParenExpr: return c.expr(v.Expr)
+	case *sqlparser.ColName: return &table.Expression{Op:table.E_COLUMN,Index:c.column(v)}
+	case *sqlparser.ValuesFuncExpr:
+		if !c.ondup { panic("invalid use of values(): << "+sqlparser.String(v)+" >>") }
+		return &table.Expression{Op:table.E_COLUMN,Index:len(c.t.Columns())+c.column(v.Name)}
+	case *sqlparser.NullVal,sqlparser.BoolVal,*sqlparser.SQLVal,sqlparser.ListArg:
+		return &table.Expression{Op:table.E_VALUE,Value:resolveValue(v)}
+	case sqlparser.ValTuple:
+		l := make([]*table.Expression,len(v))
+		for i,e := range v { l[i] = c.expr(e) }
+		return mkExpr(table.E_LIST,"",l...)
+	case *sqlparser.UnaryExpr:
+		switch v.Operator {
+		case sqlparser.UPlusStr,sqlparser.UMinusStr,sqlparser.TildaStr,sqlparser.BangStr:
+			return mkExpr(table.E_UNARY,v.Operator,c.expr(v.Expr))
+		case sqlparser.BinaryStr,sqlparser.UBinaryStr:
+			return mkExpr(table.E_CONVERT,"binary",c.expr(v.Expr))
+		}
+	case *sqlparser.BinaryExpr:
+		if op,ok := binaryOps[v.Operator]; ok { return mkExpr(table.E_BINARY,op,c.expr(v.Left),c.expr(v.Right)) }
+	case *sqlparser.ComparisonExpr:
+		switch v.Operator {
+		case sqlparser.JSONExtractOp,sqlparser.JSONUnquoteExtractOp:
+			panic("unsupported operator: "+v.Operator)
+		}
+		e := &table.Expression{Op:table.E_BINARY,Operator:v.Operator,Args:[]*table.Expression{c.expr(v.Left),c.expr(v.Right)}}
+		e.Value = resolveValue(v.Escape)
+		return fold(e)
+	case *sqlparser.RangeCond:
+		l := c.expr(v.Left)
+		f := mkExpr(table.E_BINARY,">=",l,c.expr(v.From))
+		t := mkExpr(table.E_BINARY,"<=",l,c.expr(v.To))
+		if v.Operator==sqlparser.NotBetweenStr {
+			return mkExpr(table.E_UNARY,"!",mkExpr(table.E_BINARY,"and",f,t))
+		}
+		return mkExpr(table.E_BINARY,"and",f,t)
+	case *sqlparser.IsExpr: return mkExpr(table.E_UNARY,v.Operator,c.expr(v.Expr))
+	case *sqlparser.AndExpr: return mkExpr(table.E_BINARY,"and",c.expr(v.Left),c.expr(v.Right))
+	case *sqlparser.OrExpr: return mkExpr(table.E_BINARY,"or",c.expr(v.Left),c.expr(v.Right))
+	case *sqlparser.NotExpr: return mkExpr(table.E_UNARY,"!",c.expr(v.Expr))
+	case *sqlparser.CaseExpr:
+		args := []*table.Expression{nil}
+		if v.Expr!=nil { args[0] = c.expr(v.Expr) }
+		for _,w := range v.Whens { args = append(args,c.expr(w.Cond),c.expr(w.Val)) }
+		if v.Else!=nil {
+			args = append(args,c.expr(v.Else))
+		} else {
+			args = append(args,nil)
+		}
+		return mkExpr(table.E_CASE,"",args...)
+	case *sqlparser.ConvertExpr:
+		return mkExpr(table.E_CONVERT,strings.ToLower(v.Type.Type),c.expr(v.Expr))
+	case *sqlparser.ConvertUsingExpr:
+		return mkExpr(table.E_CONVERT,"char",c.expr(v.Expr))
+	case *sqlparser.FuncExpr:
+		if c.having && isAggregate(v) { return &table.Expression{Op:table.E_COLUMN,Index:c.column(v)} }
+		if isAggregate(v) { panic("invalid use of aggregate: << "+sqlparser.String(v)+" >>") }
+		name := v.Name.Lowered()
+		if !v.Qualifier.IsEmpty() || LookupFunction(name)==nil { panic("unknown function: "+sqlparser.String(v.Name)) }
+		args := make([]*table.Expression,len(v.Exprs))
+		for i,se := range v.Exprs {
+			ae,ok := se.(*sqlparser.AliasedExpr)
+			if !ok { panic("invalid function argument: << "+sqlparser.String(se)+" >>") }
+			args[i] = c.expr(ae.Expr)
+		}
+		return c.call(name,args)
+	case *sqlparser.SubstrExpr: return c.substr(v)
+	}
+	panic("unsupported expression: << "+sqlparser.String(expr)+" >>")
+}
+
+// Returns the value of a constant expression (or placeholder), if it is one.
+func (c *compiler) constant(expr sqlparser.Expr) (interface{},bool) {
+	if expr==nil { return nil,true }
+	e := c.expr(expr)
+	if e.Op!=table.E_VALUE { return nil,false }
+	return e.Value,true
+}
+
+// Compiles a select expression, that is computed from the scanned columns.
+func (c *compiler) computed(expr sqlparser.Expr) *table.Expression {
+	e := c.expr(expr)
+	if c.srcs==nil {
+		// Make sure, every column is scanned.
+		for _,i := range e.Columns(nil) { c.scanPos(i) }
+	}
+	c.isComputed = true
+	return e
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/xwb1989/sqlparser"
+import "fmt"
+import "sync"
+import "strings"
+
+/*
+A scalar function, callable from any expression. Calls of functions, that
+are not Volatile, are evaluated at compile time, if their arguments are
+constant, and over the rows otherwise.
+*/
+type Function struct {
+	// The number of arguments: At least MinArgs, at most MaxArgs, or any
+	// number, if MaxArgs is negative.
+	MinArgs,MaxArgs int
+	
+	// The function is called with NULL arguments. Otherwise, the result is
+	// NULL, if any argument is NULL.
+	NullArgs bool
+	
+	// The result may differ between calls with the same arguments, as for
+	// NOW() or RAND().
+	Volatile bool
+	
+	Call table.ScalarFunc
+	
+	call table.ScalarFunc
+}
+
+var functions = struct {
+	sync.RWMutex
+	m map[string]*Function
+}{m:make(map[string]*Function)}
+
+// Registers a function under the (case insensitive) 'name', replacing a previous one.
+func RegisterFunction(name string,f *Function) {
+	nf := *f
+	nf.call = f.Call
+	if !f.NullArgs {
+		nf.call = func(args []interface{}) (interface{},error) {
+			for _,a := range args { if a==nil { return nil,nil } }
+			return f.Call(args)
+		}
+	}
+	functions.Lock(); defer functions.Unlock()
+	functions.m[strings.ToLower(name)] = &nf
+}
+
+// Returns the function 'name', or nil.
+func LookupFunction(name string) *Function {
+	functions.RLock(); defer functions.RUnlock()
+	return functions.m[strings.ToLower(name)]
+}
+
+// Compiles a call of the function 'name'.
+func (c *compiler) call(name string,args []*table.Expression) *table.Expression {
+	f := LookupFunction(name)
+	if f==nil { panic("unknown function: "+name) }
+	if len(args)<f.MinArgs || (f.MaxArgs>=0 && len(args)>f.MaxArgs) {
+		panic(fmt.Sprintf("wrong number of arguments to %s: %d",name,len(args)))
+	}
+	e := &table.Expression{Op:table.E_FUNC,Operator:strings.ToLower(name),Value:f.call,Args:args}
+	if f.Volatile { return e }
+	return fold(e)
+}
+
+// SUBSTRING(col FROM pos FOR len) and its variants.
+func (c *compiler) substr(v *sqlparser.SubstrExpr) *table.Expression {
+	args := []*table.Expression{c.expr(v.Name),c.expr(v.From)}
+	if v.To!=nil { args = append(args,c.expr(v.To)) }
+	return c.call("substring",args)
+}
@@ -35,6 +35,7 @@ type insertCompiler struct {
 	cols []int
 	
 	values [][]interface{}
+	source *Query
 	op table.TableOp
 	
 	ondup_cols []int
@@ -52,9 +53,7 @@ func (c *insertCompiler) getCol(n string) int {
 	return i
 }
 func (c *insertCompiler) compileInsert(s *Schema,dml *sqlparser.Insert) {
-	if(dml.OnDup!=nil) { panic("unsupported: on duplicate key update ...") }
-	
-	c.t = s.Get(dml.Table.Name.String())
+	c.t = s.GetQualified(dml.Table)
 	if c.t==nil { panic("table not found: "+sqlparser.String(dml.Table)) }
 	c.setupTable()
 	
@@ -62,14 +61,32 @@ func (c *insertCompiler) compileInsert(s *Schema,dml *sqlparser.Insert) {
 	c.cols = make([]int,len(dml.Columns))
 	for i,col := range dml.Columns { c.cols[i] = c.getCol(col.String()) }
 	
-	switch v := dml.Rows.(type) {
+	rows := dml.Rows
+	if p,ok := rows.(*sqlparser.ParenSelect); ok {
+		if sel,ok := p.Select.(*sqlparser.Select); ok { rows = sel }
+	}
+	switch v := rows.(type) {
+	case *sqlparser.Select:
+		q,err := s.CompileQuery(v)
+		if err!=nil { panic(err) }
+		n := len(c.cols)
+		if c.allCols { n = len(c.t.Columns()) }
+		if len(q.Names)!=n { panic(fmt.Sprintf("column count mismatch: %d columns, %d values",n,len(q.Names))) }
+		c.source = q
 	case sqlparser.Values:
+		// Values, that are not constant (such as NOW()), are evaluated on every execution.
+		vc := &compiler{s:s}
 		c.values = make([][]interface{},len(v))
 		for j,vv := range v {
 			row := make([]interface{},len(vv))
 			c.values[j] = row
 			for jj,vvv := range vv {
-				row[jj] = resolveValue(vvv)
+				e := vc.expr(vvv)
+				if e.Op==table.E_VALUE {
+					row[jj] = e.Value
+				} else {
+					row[jj] = e
+				}
 			}
 		}
 	default: panic(fmt.Sprintf("unsupported in insert: %T(%v)",v,v))
@@ -89,9 +106,24 @@ func (c *insertCompiler) compileInsert(s *Schema,dml *sqlparser.Insert) {
 	c.ondup_cols = make([]int,len(dml.OnDup))
 	c.ondup_vals = make([]interface{},len(dml.OnDup))
 	
+	// The update takes precedence over IGNORE.
+	if len(dml.OnDup)!=0 {
+		switch c.op {
+		case table.T_InsertIgnore: c.op = table.T_Insert
+		case table.T_Replace: panic("illegal: replace ... on duplicate key update")
+		}
+	}
+	oc := &compiler{s:s,t:c.t,ondup:true}
+	oc.setupTable()
+	oc.setName(dml.Table)
 	for i,upd := range dml.OnDup {
+		oc.checkTable(upd.Name.Qualifier,upd.Name)
 		c.ondup_cols[i] = c.getCol(upd.Name.Name.String())
-		c.ondup_vals[i] = resolveValue(upd.Expr)
+		if v,ok := oc.constant(upd.Expr); ok {
+			c.ondup_vals[i] = v
+		} else {
+			c.ondup_vals[i] = oc.expr(upd.Expr)
+		}
 	}
 }
 
@@ -116,6 +148,7 @@ func (s *Schema) CompileInsert(dml *sqlparser.Insert) (tab table.Table,job *tabl
 	defer func() { if r := recover(); r!=nil { err = any2err(r) } }()
 	c := new(insertCompiler)
 	c.compileInsert(s,dml)
+	if c.source!=nil { panic("insert ... select: use CompileInsertSelect") }
 	
 	tab = c.t
 	job = new(table.TableInsert)
@@ -126,6 +159,61 @@ func (s *Schema) CompileInsert(dml *sqlparser.Insert) (tab table.Table,job *tabl
 	
 	job.OndupCols = c.ondup_cols
 	job.OndupVals = c.ondup_vals
+	typeInsert(tab,job)
 	return
 }
 
+
+/*
+An INSERT ... SELECT statement. The result rows of 'Source' are inserted
+into 'Table' using 'Job', whose Values are to be filled by the caller, one
+batch at a time.
+*/
+type InsertSelect struct {
+	Table  table.Table
+	Job    *table.TableInsert
+	Source *Query
+}
+
+// Returns a copy of the statement, that shares no placeholders with 'is'.
+func (is *InsertSelect) Clone() *InsertSelect {
+	return &InsertSelect{is.Table,is.Job.Clone(),is.Source.Clone()}
+}
+
+// Returns true, if the source query scans the target table.
+func (is *InsertSelect) SelfReferencing() bool {
+	if is.Source.Table==is.Table { return true }
+	for _,j := range is.Source.Joins {
+		if j.Table==is.Table { return true }
+	}
+	return false
+}
+
+// Returns true, if the rows of the insert-statement come from a select-statement.
+func IsInsertSelect(dml *sqlparser.Insert) bool {
+	switch v := dml.Rows.(type) {
+	case *sqlparser.Select: return true
+	case *sqlparser.ParenSelect:
+		_,ok := v.Select.(*sqlparser.Select)
+		return ok
+	}
+	return false
+}
+
+// Compiles an insert-statement, whose rows come from a select-statement. See IsInsertSelect().
+func (s *Schema) CompileInsertSelect(dml *sqlparser.Insert) (is *InsertSelect,err error) {
+	defer func() { if r := recover(); r!=nil { err = any2err(r) } }()
+	c := new(insertCompiler)
+	c.compileInsert(s,dml)
+	if c.source==nil { panic("not an insert ... select") }
+	
+	job := new(table.TableInsert)
+	job.AllCols = c.allCols
+	job.Cols = c.cols
+	job.Op = c.op
+	job.OndupCols = c.ondup_cols
+	job.OndupVals = c.ondup_vals
+	typeInsert(c.t,job)
+	is = &InsertSelect{c.t,job,c.source}
+	return
+}
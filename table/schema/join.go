@@ -0,0 +1,305 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package schema
+
+import "github.com/mad-day/db-utils/table"
+import "github.com/xwb1989/sqlparser"
+import "strings"
+
+/*
+A table joined to a query. For every input row so far, the rows of 'Table',
+scanned for the columns 'Cols' and filtered by 'Scan', are joined, if the
+table columns 'InnerKeys' equal the input row's columns at 'OuterKeys', and
+the predicate 'On' holds on the joined row (positions in the input row).
+
+For a LEFT join, input rows without a matching row are joined with NULLs.
+*/
+type Join struct {
+	Table table.Table
+	Cols  []int
+	Scan  *table.TableScan
+	Left  bool
+	
+	OuterKeys []int
+	InnerKeys []int
+	On        *table.Predicate
+}
+
+// A table in the from clause of a join query.
+type source struct {
+	t    table.Table
+	name string
+	
+	// The schema name of an unaliased table, qualifying 'name'.
+	schema string
+	tm   map[string]int
+	off  int
+	scan *table.TableScan
+	join *Join
+}
+
+func isJoin(from sqlparser.TableExprs) bool {
+	if len(from)!=1 { return true }
+	switch v := from[0].(type) {
+	case *sqlparser.ParenTableExpr: return isJoin(v.Exprs)
+	case *sqlparser.JoinTableExpr: return true
+	}
+	return false
+}
+
+func allColumns(t table.Table) []int {
+	cols := make([]int,len(t.Columns()))
+	for i := range cols { cols[i] = i }
+	return cols
+}
+
+func andPredicate(p,q *table.Predicate) *table.Predicate {
+	switch {
+	case p==nil: return q
+	case p.Op==table.P_AND: p.Args = append(p.Args,q); return p
+	}
+	return mkPredicate(table.P_AND,p,q)
+}
+
+// Splits an expression into its conjuncts.
+func conjuncts(expr sqlparser.Expr,dst []sqlparser.Expr) []sqlparser.Expr {
+	switch v := unparen(expr).(type) {
+	case *sqlparser.AndExpr:
+		dst = conjuncts(v.Left,dst)
+		return conjuncts(v.Right,dst)
+	}
+	return append(dst,expr)
+}
+
+// Adds a table to the from clause. Every table but the first is joined.
+func (c *compiler) addSource(v *sqlparser.AliasedTableExpr,left bool) *source {
+	sx,ok := v.Expr.(sqlparser.TableName)
+	if !ok { panic("invalid table expression: << "+sqlparser.String(v.Expr)+" >>") }
+	t := c.s.GetQualified(sx)
+	if t==nil { panic("table not found: "+sqlparser.String(sx)) }
+	src := &source{t:t,name:strings.ToLower(sx.Name.String()),schema:c.s.Name}
+	if !sx.Qualifier.IsEmpty() { src.schema = strings.ToLower(sx.Qualifier.String()) }
+	if !v.As.IsEmpty() { src.name,src.schema = strings.ToLower(v.As.String()),"" }
+	for _,o := range c.srcs {
+		if o.name==src.name && o.schema==src.schema { panic("not unique table/alias: "+src.name) }
+	}
+	src.tm = make(map[string]int)
+	for i,n := range t.Columns() { src.tm[strings.ToLower(n)] = i }
+	if n := len(c.srcs); n!=0 {
+		last := c.srcs[n-1]
+		src.off = last.off+len(last.t.Columns())
+	}
+	c.srcs = append(c.srcs,src)
+	
+	if len(c.srcs)==1 {
+		c.t,c.tm,c.cols = t,src.tm,allColumns(t)
+		src.scan = c.scan
+		return src
+	}
+	src.scan = new(table.TableScan)
+	src.join = &Join{Table:t,Cols:allColumns(t),Scan:src.scan,Left:left}
+	c.joins = append(c.joins,src.join)
+	return src
+}
+
+func (c *compiler) addFrom(expr sqlparser.TableExpr) {
+	switch v := expr.(type) {
+	case *sqlparser.ParenTableExpr:
+		for _,e := range v.Exprs { c.addFrom(e) }
+	case *sqlparser.AliasedTableExpr:
+		c.addSource(v,false)
+	case *sqlparser.JoinTableExpr:
+		c.addFrom(v.LeftExpr)
+		left := false
+		switch v.Join {
+		case sqlparser.JoinStr,sqlparser.StraightJoinStr:
+		case sqlparser.LeftJoinStr: left = true
+		default: panic("unsupported join: "+v.Join)
+		}
+		right,ok := v.RightExpr.(*sqlparser.AliasedTableExpr)
+		if !ok { panic("unsupported join operand: << "+sqlparser.String(v.RightExpr)+" >>") }
+		src := c.addSource(right,left)
+		for _,col := range v.Condition.Using { c.addUsing(src,col) }
+		if v.Condition.On!=nil {
+			for _,e := range conjuncts(v.Condition.On,nil) { c.addJoinConjunct(src,e) }
+		}
+	default:
+		panic("invalid table expression: << "+sqlparser.String(expr)+" >>")
+	}
+}
+
+/*
+Finds the table 'tn' of the from clause, referred to by 'ref'. A name without
+a schema name matches the tables of any schema, but must be unique.
+*/
+func (c *compiler) source(tn sqlparser.TableName,ref sqlparser.SQLNode) *source {
+	q := strings.ToLower(tn.Name.String())
+	qs := strings.ToLower(tn.Qualifier.String())
+	var found *source
+	for _,src := range c.srcs {
+		if src.name!=q || (qs!="" && src.schema!=qs) { continue }
+		if found!=nil { panic("table is ambiguous: "+sqlparser.String(tn)+" in << "+sqlparser.String(ref)+" >>") }
+		found = src
+	}
+	if found==nil { unknownTable(tn,ref) }
+	return found
+}
+
+// Resolves a column reference to its table and column index.
+func (c *compiler) resolve(expr sqlparser.Expr) (*source,int) {
+	v,ok := unparen(expr).(*sqlparser.ColName)
+	if !ok { panic("invalid column expression: << "+sqlparser.String(expr)+" >>") }
+	n := strings.ToLower(v.Name.String())
+	if !v.Qualifier.IsEmpty() {
+		src := c.source(v.Qualifier,v)
+		i,ok := src.tm[n]
+		if !ok { panic("column not found: "+sqlparser.String(v)) }
+		return src,i
+	}
+	var found *source
+	idx := -1
+	for _,src := range c.srcs {
+		i,ok := src.tm[n]
+		if !ok { continue }
+		if found!=nil { panic("column is ambiguous: "+v.Name.String()) }
+		found,idx = src,i
+	}
+	if found==nil { panic("column not found: "+v.Name.String()) }
+	return found,idx
+}
+func (c *compiler) position(expr sqlparser.Expr) int {
+	src,i := c.resolve(expr)
+	return src.off+i
+}
+
+// Returns the tables, an expression refers to.
+func (c *compiler) sourcesOf(expr sqlparser.Expr) (srcs []*source) {
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool,error) {
+		cn,ok := node.(*sqlparser.ColName)
+		if !ok { return true,nil }
+		src,_ := c.resolve(cn)
+		for _,o := range srcs { if o==src { return false,nil } }
+		srcs = append(srcs,src)
+		return false,nil
+	},expr)
+	return
+}
+
+// Pushes a predicate, that refers to 'src' only, into its scan.
+func (c *compiler) pushFilter(src *source,expr sqlparser.Expr) {
+	scan := c.scan
+	c.scan,c.local = src.scan,src
+	defer func() { c.scan,c.local = scan,nil }()
+	c.addFilter(expr)
+}
+
+func (c *compiler) addUsing(src *source,col sqlparser.ColIdent) {
+	n := strings.ToLower(col.String())
+	i,ok := src.tm[n]
+	if !ok { panic("column not found: "+col.String()) }
+	var outer *source
+	for _,o := range c.srcs[:len(c.srcs)-1] {
+		if _,ok := o.tm[n]; !ok { continue }
+		if outer!=nil { panic("column is ambiguous: "+col.String()) }
+		outer = o
+	}
+	if outer==nil { panic("column not found: "+col.String()) }
+	src.join.OuterKeys = append(src.join.OuterKeys,outer.off+outer.tm[n])
+	src.join.InnerKeys = append(src.join.InnerKeys,i)
+}
+
+func (c *compiler) addJoinConjunct(src *source,expr sqlparser.Expr) {
+	srcs := c.sourcesOf(expr)
+	if len(srcs)==1 && srcs[0]==src {
+		c.pushFilter(src,expr)
+		return
+	}
+	if v,ok := unparen(expr).(*sqlparser.ComparisonExpr); ok && v.Operator==sqlparser.EqualStr {
+		_,lc := unparen(v.Left).(*sqlparser.ColName)
+		_,rc := unparen(v.Right).(*sqlparser.ColName)
+		if lc && rc {
+			ls,li := c.resolve(v.Left)
+			rs,ri := c.resolve(v.Right)
+			if rs==src { ls,li,rs,ri = rs,ri,ls,li }
+			if ls==src && rs!=src {
+				src.join.InnerKeys = append(src.join.InnerKeys,li)
+				src.join.OuterKeys = append(src.join.OuterKeys,rs.off+ri)
+				return
+			}
+		}
+	}
+	src.join.On = andPredicate(src.join.On,c.predicate(expr))
+}
+
+/*
+Adds the where clause. In join queries, a conjunct is evaluated as early as
+possible: Conjuncts, that refer to the first table only, are pushed into its
+scan, and conjuncts, whose last table is joined by an inner join, become part
+of that join's condition.
+*/
+func (c *compiler) addWhere(expr sqlparser.Expr) {
+	if c.srcs==nil {
+		c.addFilter(expr)
+		return
+	}
+	for _,e := range conjuncts(expr,nil) {
+		var last *source
+		for _,src := range c.sourcesOf(e) {
+			if last==nil || src.off>last.off { last = src }
+		}
+		switch {
+		case last==nil || last.join==nil: c.pushFilter(c.srcs[0],e)
+		case !last.join.Left: c.addJoinConjunct(last,e)
+		default: c.where = andPredicate(c.where,c.predicate(e))
+		}
+	}
+}
+
+// Adds a select expression of a join query.
+func (c *compiler) appendJoined(s sqlparser.SelectExpr) {
+	switch v := s.(type) {
+	case *sqlparser.StarExpr:
+		srcs := c.srcs
+		if !v.TableName.IsEmpty() { srcs = []*source{c.source(v.TableName,v)} }
+		for _,src := range srcs {
+			for i,n := range src.t.Columns() {
+				c.output = append(c.output,src.off+i)
+				c.names = append(c.names,n)
+				c.exprs = append(c.exprs,&table.Expression{Op:table.E_COLUMN,Index:src.off+i})
+			}
+		}
+	case *sqlparser.AliasedExpr:
+		if _,ok := unparen(v.Expr).(*sqlparser.ColName); ok {
+			p := c.position(v.Expr)
+			c.output = append(c.output,p)
+			c.exprs = append(c.exprs,&table.Expression{Op:table.E_COLUMN,Index:p})
+		} else {
+			c.output = append(c.output,-1)
+			c.exprs = append(c.exprs,c.computed(v.Expr))
+		}
+		c.names = append(c.names,colName(v))
+	default:
+		panic("invalid select expression: << "+sqlparser.String(s)+" >>")
+	}
+}
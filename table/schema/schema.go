@@ -24,46 +24,132 @@ SOFTWARE.
 package schema
 
 import "github.com/mad-day/db-utils/table"
+import "github.com/mad-day/db-utils/table/util"
 import "github.com/xwb1989/sqlparser"
 import "strings"
 import "strconv"
 import "fmt"
-import "time"
 import "encoding/hex"
+import "sync"
+import "sync/atomic"
 
 type PlaceHolder struct{
 	ListArg bool
 	Name string
+	
+	// The column, the placeholder is compared with or assigned to, and its
+	// type, attached by the compiler. Nil, if unknown.
+	ColumnName string
+	Type *table.ColumnType
+	
+	// The placeholder is assigned to the column, rather than compared with it.
+	Assign bool
+}
+func (p PlaceHolder) String() string {
+	if p.ListArg { return "::"+p.Name }
+	return ":"+p.Name
+}
+
+// The metadata of a placeholder.
+type Param struct{
+	Name string
+	ListArg bool
+	
+	// The table column, the placeholder is compared with or assigned to.
+	// Nil and -1, if unknown.
+	Table table.Table
+	Column int
+	
+	// The name and type of that column, see PlaceHolder. Nil, if unknown.
+	ColumnName string
+	Type *table.ColumnType
+	
+	// The placeholder is assigned to the column at one occurrence at least.
+	Assign bool
+	
+	// The order of the first occurrence within the statement.
+	Pos int
 }
 
+/*
+Sets the value of a placeholder at every occurrence. A list placeholder is
+set by one Put() per element.
+*/
 type Setter struct{
-	ptr *interface{}
+	Param
+	ptrs []*interface{}
 	arr []interface{}
-	listArg bool
+	isSet bool
+	
+	// The placeholder is used as list and as scalar.
+	Mixed bool
+}
+func (s *Setter) set(v interface{}) {
+	for _,p := range s.ptrs { *p = v }
 }
 func (s *Setter) Reset() {
-	if !s.listArg { return }
+	s.isSet = false
+	if !s.ListArg {
+		s.set(nil)
+		return
+	}
 	s.arr = s.arr[:0]
-	*s.ptr = s.arr
+	s.set([]interface{}(nil))
 }
 func (s *Setter) Put(val interface{}) {
-	if !s.listArg {
-		*s.ptr = val
+	s.isSet = true
+	if !s.ListArg {
+		s.set(val)
 		return
 	}
 	s.arr = append(s.arr,val)
-	*s.ptr = s.arr
+	s.set(s.arr)
 }
 
+/*
+Converts a value into the type of the placeholder's column (see util.Coerce),
+so that it can be passed to Put(). Values, that are only compared with the
+column, are passed unchanged, if they can't be converted without loss.
+*/
+func (s *Setter) Coerce(val interface{}) (interface{},error) {
+	if !s.Assign {
+		if v,err := util.Coerce(val,s.Type); err==nil { return v,nil }
+		return val,nil
+	}
+	v,err := util.Coerce(val,s.Type)
+	if err!=nil { return nil,fmt.Errorf("%v for column %s",err,s.ColumnName) }
+	return v,nil
+}
+
+// Sets a list placeholder to the elements of 'vals'.
+func (s *Setter) PutList(vals []interface{}) {
+	s.isSet = true
+	s.arr = append(s.arr[:0],vals...)
+	s.set(s.arr)
+}
+
+// Reports, whether Put() has been called since the last Reset().
+func (s *Setter) IsSet() bool { return s.isSet }
+
 type SetterMap map[string]*Setter
 
 func (sm SetterMap) Reset() {
 	for _,s := range sm { s.Reset() }
 }
-func (sm SetterMap) useph(i *interface{}) {
+func (sm SetterMap) useph(i *interface{}) { sm.usephOf(i,nil,-1) }
+func (sm SetterMap) usephOf(i *interface{},tab table.Table,col int) {
 	ph,ok := (*i).(PlaceHolder)
 	if !ok { return }
-	sm[ph.Name] = &Setter{i,nil,ph.ListArg}
+	s := sm[ph.Name]
+	if s==nil {
+		s = &Setter{Param:Param{Name:ph.Name,ListArg:ph.ListArg,Column:-1,Pos:len(sm)}}
+		sm[ph.Name] = s
+	}
+	if s.ListArg!=ph.ListArg { s.Mixed = true }
+	if s.Table==nil && tab!=nil { s.Table,s.Column = tab,col }
+	if ph.Type!=nil && (s.Type==nil || ph.Assign && !s.Assign) { s.ColumnName,s.Type = ph.ColumnName,ph.Type }
+	if ph.Assign { s.Assign = true }
+	s.ptrs = append(s.ptrs,i)
 	if ph.ListArg {
 		*i = []interface{}(nil)
 	} else {
@@ -74,16 +160,62 @@ func (sm SetterMap) useph(i *interface{}) {
 // If you know what you are doing!
 func (sm SetterMap) Dangerous_Inspect(i *interface{}) { sm.useph(i) }
 
-func (sm SetterMap) InspectTableScan(scan *table.TableScan) {
+// Returns the placeholders in the order of their first occurrence.
+func (sm SetterMap) Params() []*Param {
+	ps := make([]*Param,len(sm))
+	for _,s := range sm { ps[s.Pos] = &s.Param }
+	return ps
+}
+
+func (sm SetterMap) inspectFilter(f *table.ColumnFilter) { sm.inspectFilterOf(nil,f) }
+func (sm SetterMap) inspectFilterOf(tab table.Table,f *table.ColumnFilter) {
+	col := -1
+	if tab!=nil { col = f.Index }
+	if l,ok := f.Value.([]interface{}); ok {
+		for i := range l { sm.usephOf(&(l[i]),tab,col) }
+	}
+	sm.usephOf(&(f.Value),tab,col)
+	sm.useph(&(f.Escape))
+}
+func (sm SetterMap) InspectTableScan(scan *table.TableScan) { sm.InspectTableScanOf(nil,scan) }
+
+// Like InspectTableScan, but records the columns of 'tab', the placeholders are compared with.
+func (sm SetterMap) InspectTableScanOf(tab table.Table,scan *table.TableScan) {
 	for i := range scan.Filter {
-		sm.useph(&(scan.Filter[i].Value))
-		sm.useph(&(scan.Filter[i].Escape))
+		sm.inspectFilterOf(tab,&(scan.Filter[i]))
 	}
+	scan.Where.Walk(func(f *table.ColumnFilter) { sm.inspectFilterOf(tab,f) })
+	scan.Where.WalkExpr(sm.inspectExpr)
+	sm.useph(&(scan.Limit))
+	sm.useph(&(scan.Offset))
+}
+func (sm SetterMap) InspectPredicate(p *table.Predicate) {
+	p.Walk(sm.inspectFilter)
+	p.WalkExpr(sm.inspectExpr)
+}
+func (sm SetterMap) inspectExpr(e *table.Expression) {
+	sm.useph(&(e.Value))
+}
+func (sm SetterMap) InspectExpression(e *table.Expression) {
+	e.Walk(sm.inspectExpr)
 }
 
-func (sm SetterMap) InspectTuple(tuple []interface{}) {
+func (sm SetterMap) InspectTuple(tuple []interface{}) { sm.InspectTupleOf(nil,nil,tuple) }
+
+// Like InspectTuple, but the values are assigned to the columns 'cols' of 'tab' (all columns, if nil).
+func (sm SetterMap) InspectTupleOf(tab table.Table,cols []int,tuple []interface{}) {
 	for i := range tuple {
-		sm.useph(&(tuple[i]))
+		if e,ok := tuple[i].(*table.Expression); ok {
+			sm.InspectExpression(e)
+			continue
+		}
+		col := -1
+		switch {
+		case tab==nil:
+		case cols==nil: col = i
+		case i<len(cols): col = cols[i]
+		}
+		sm.usephOf(&(tuple[i]),tab,col)
 	}
 }
 func (sm SetterMap) InspectTuples(tuples [][]interface{}) {
@@ -91,6 +223,11 @@ func (sm SetterMap) InspectTuples(tuples [][]interface{}) {
 		sm.InspectTuple(tuple)
 	}
 }
+func (sm SetterMap) InspectTuplesOf(tab table.Table,cols []int,tuples [][]interface{}) {
+	for _,tuple := range tuples {
+		sm.InspectTupleOf(tab,cols,tuple)
+	}
+}
 
 
 /*
@@ -106,110 +243,70 @@ func FindPlaceHolders(scan *table.TableScan) SetterMap {
 	return sm
 }
 
+/*
+Attaches the name and type of the column 'col' of 'tab' to the placeholders in
+'*v', which are assigned to the column, if 'assign' is true.
+*/
+func typePlaceHolder(v *interface{},tab table.Table,col int,assign bool) {
+	tt,ok := tab.(table.TypedTable)
+	if !ok || col<0 { return }
+	types,names := tt.ColumnTypes(),tab.Columns()
+	if col>=len(types) || col>=len(names) { return }
+	switch ph := (*v).(type) {
+	case PlaceHolder:
+		ph.ColumnName,ph.Type,ph.Assign = names[col],&types[col],assign
+		*v = ph
+	case []interface{}:
+		for i := range ph { typePlaceHolder(&ph[i],tab,col,assign) }
+	}
+}
+
+// LIKE patterns are no values of the column.
+func typeFilter(tab table.Table,f *table.ColumnFilter) {
+	switch f.Operator {
+	case "like","not like": return
+	}
+	typePlaceHolder(&f.Value,tab,f.Index,false)
+}
+func typeScan(tab table.Table,scan *table.TableScan) {
+	if scan==nil { return }
+	for i := range scan.Filter { typeFilter(tab,&scan.Filter[i]) }
+	scan.Where.Walk(func(f *table.ColumnFilter) { typeFilter(tab,f) })
+}
+
+// Like SetterMap.InspectTupleOf.
+func typeTuple(tab table.Table,cols []int,tuple []interface{}) {
+	for i := range tuple {
+		col := i
+		if cols!=nil {
+			if i>=len(cols) { return }
+			col = cols[i]
+		}
+		typePlaceHolder(&tuple[i],tab,col,true)
+	}
+}
+
+func typeQuery(q *Query) {
+	typeScan(q.Table,q.Scan)
+	for _,j := range q.Joins { typeScan(j.Table,j.Scan) }
+}
+func typeInsert(tab table.Table,ti *table.TableInsert) {
+	cols := ti.Cols
+	if ti.AllCols { cols = nil }
+	for _,tuple := range ti.Values { typeTuple(tab,cols,tuple) }
+	typeTuple(tab,ti.OndupCols,ti.OndupVals)
+}
+
 func any2err(i interface{}) error {
 	e,ok := i.(error)
 	if !ok { e = fmt.Errorf("%v",i) }
 	return e
 }
 
-const tsf2 = "2006-01-02 15:04:05.999999999"
-const tsf1 = "2006-01-02 15:04:05"
-const tdf1 = "2006-01-02"
-const tdf2 = "15:04:05"
-
-func parseOptUint(s string,u bool) (i int64,e error) {
-	if u {
-		var ui uint64
-		ui,e = strconv.ParseUint(s,-1,64)
-		i = int64(ui)
-	} else {
-		i,e = strconv.ParseInt(s,-1,64)
-	}
-	return
-}
 func tryConvert(i interface{},ct *sqlparser.ConvertType) interface{}{
-	// http://www.mysqltutorial.org/mysql-cast/
-	switch ct.Type {
-	// int64
-	case "signed","unsigned":
-		switch v := i.(type) {
-		case nil: return int64(0)
-		case int64: return i
-		case float64: return int64(v)
-		case string:
-			b,e := parseOptUint(v,ct.Type=="unsigned")
-			if e!=nil { panic(e) }
-			return b
-		case []byte:
-			b,e := parseOptUint(string(v),ct.Type=="unsigned")
-			if e!=nil { panic(e) }
-			return b
-		}
-	// float64
-	case "decimal":
-		switch v := i.(type) {
-		case nil: return float64(0)
-		case int64: return float64(v)
-		case float64: return i
-		case string:
-			b,e := strconv.ParseFloat(v,64)
-			if e!=nil { panic(e) }
-			return b
-		case []byte:
-			b,e := strconv.ParseFloat(string(v),64)
-			if e!=nil { panic(e) }
-			return b
-		}
-	// []byte
-	case "binary":
-		switch v := i.(type) {
-		case nil: return []byte(nil)
-		case int64: return []byte(strconv.FormatInt(v,10))
-		case float64: return []byte(strconv.FormatFloat(v,'f',-1,64))
-		case bool: if v { return []byte("true") } else { return []byte("false") }
-		case []byte: return i
-		case string: return []byte(v)
-		case time.Time: return v.AppendFormat(make([]byte,0,len(tsf2)),tsf2)
-		}
-	// string
-	case "char":
-		switch v := i.(type) {
-		case nil: return ""
-		case int64: return strconv.FormatInt(v,10)
-		case float64: return strconv.FormatFloat(v,'f',-1,64)
-		case bool: if v { return "true" } else { return "false" }
-		case []byte: return string(v)
-		case string: return i
-		case time.Time: return v.Format(tsf2)
-		}
-	// time.Time
-	case "time","date","datetime":
-		s := ""
-		switch v := i.(type) {
-		case nil: return time.Time{}
-		case []byte: s = string(v)
-		case string: s = v
-		default: goto done
-		}
-		if s == "" { return time.Time{} }
-		var tm time.Time
-		var e error
-		switch ct.Type {
-		case "datetime":
-			tm,e = time.Parse(tsf2,s)
-			if e==nil { break }
-			tm,e = time.Parse(tsf1,s)
-		case "date":
-			tm,e = time.Parse(tdf1,s)
-		case "time":
-			tm,e = time.Parse(tdf2,s)
-		}
-		if e!=nil { panic(e) }
-		return tm
-	}
-	
-	done:
-	panic(fmt.Sprintf("cant convert %T(%v) into %s",i,i,ct.Type))
+	v,err := util.Convert(i,strings.ToLower(ct.Type))
+	if err!=nil { panic(err) }
+	return v
 }
 
 func resolveValue(expr sqlparser.Expr) interface{} {
@@ -234,24 +331,58 @@ func resolveValue(expr sqlparser.Expr) interface{} {
 			if err!=nil { panic(err) }
 			return nv[:i]
 		//case sqlparser.BitVal:
-		case sqlparser.ValArg: return PlaceHolder{false,string(v.Val[1:])}
+		case sqlparser.ValArg: return PlaceHolder{Name:string(v.Val[1:])}
 		}
-	case sqlparser.ListArg: return PlaceHolder{true,string(v[2:])}
+	case sqlparser.ListArg: return PlaceHolder{ListArg:true,Name:string(v[2:])}
 	case *sqlparser.ConvertExpr: return tryConvert(resolveValue(v.Expr),v.Type)
 	}
+	// Constant expressions, such as -1 or 2*3.
+	if e := new(compiler).expr(expr); e.Op==table.E_VALUE { return e.Value }
 	panic("error resolving "+sqlparser.String(expr))
 }
 
 
+/*
+A set of named tables. Tables must only be modified through Put() and Delete(),
+while the schema is in use.
+*/
 type Schema struct {
 	Tables map[string]table.Table
+	
+	// Creates and drops tables on DDL statements. Nil, if DDL is unsupported.
+	Factory TableFactory
+	
+	// The name of the schema and the catalog, qualified table names are
+	// resolved against. Set by Catalog.Put().
+	Name string
+	Catalog *Catalog
+	
+	version uint64
+	mu sync.RWMutex
 }
 func (s *Schema) Put(n string,t table.Table) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.put(n,t)
+}
+func (s *Schema) put(n string,t table.Table) {
 	if s.Tables==nil { s.Tables = make(map[string]table.Table) }
 	s.Tables[strings.ToLower(n)] = t
+	atomic.AddUint64(&s.version,1)
+}
+func (s *Schema) Delete(n string) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.delete(n)
 }
+func (s *Schema) delete(n string) {
+	delete(s.Tables,strings.ToLower(n))
+	atomic.AddUint64(&s.version,1)
+}
+
+// Returns a counter, that changes whenever a table is put or deleted.
+func (s *Schema) Version() uint64 { return atomic.LoadUint64(&s.version) }
 func (s *Schema) Get(n string) table.Table {
 	if s==nil { return nil }
+	s.mu.RLock(); defer s.mu.RUnlock()
 	return s.Tables[strings.ToLower(n)]
 }
 
@@ -261,13 +392,41 @@ type compiler struct {
 	s *Schema
 	t table.Table
 	tm map[string]int
+	
+	// The name (or alias) and schema name of 't', qualified columns must refer to.
+	name,schema string
+	
 	cols []int
+	names []string
+	
+	// Computed select expressions: One expression per result column.
+	exprs []*table.Expression
+	isComputed bool
 	
 	scan *table.TableScan
 	
+	// Aggregation: In 'having' mode, columns resolve to the intermediate row.
+	agg *Aggregation
+	having bool
+	aliases map[string]int
+	
+	// The aliases of computed result columns, see Aggregation.OrderResult.
+	exprAliases map[string]int
+	
+	// Joins: Columns resolve to the input row, or to the table 'local'.
+	srcs   []*source
+	local  *source
+	joins  []*Join
+	where  *table.Predicate
+	order  []table.ColumnOrder
+	output []int
+	
 	op table.TableOp
 	updCols []int
 	updVals []interface{}
+	
+	// ON DUPLICATE KEY UPDATE: VALUES(col) refers to the inserted row.
+	ondup bool
 }
 func (c *compiler) setupTable() {
 	c.tm = make(map[string]int)
@@ -284,20 +443,41 @@ func (c *compiler) setTable(expr sqlparser.TableExpr) {
 		goto restart
 	case *sqlparser.AliasedTableExpr:
 		if sx,ok := v.Expr.(sqlparser.TableName); ok {
-			n := sx.Name.String()
-			c.t = c.s.Get(n)
+			c.t = c.s.GetQualified(sx)
 			if c.t==nil { panic("table not found: "+sqlparser.String(sx)) }
 			c.setupTable()
+			c.setName(sx)
+			if !v.As.IsEmpty() { c.name,c.schema = strings.ToLower(v.As.String()),"" }
 		} else {
 			panic("invalid table expression: << "+sqlparser.String(v.Expr)+" >>")
 		}
 	}
 }
+func (c *compiler) setName(tn sqlparser.TableName) {
+	c.name,c.schema = strings.ToLower(tn.Name.String()),c.s.Name
+	if !tn.Qualifier.IsEmpty() { c.schema = strings.ToLower(tn.Qualifier.String()) }
+}
+
+// Panics with an error, naming the unknown table 'tn' and the reference 'ref' to it.
+func unknownTable(tn sqlparser.TableName,ref sqlparser.SQLNode) {
+	panic("unknown table: "+sqlparser.String(tn)+" in << "+sqlparser.String(ref)+" >>")
+}
+
+/*
+Checks, that the table 'tn' (the qualifier of 'ref') is the table of the
+query. The schema name may be omitted.
+*/
+func (c *compiler) checkTable(tn sqlparser.TableName,ref sqlparser.SQLNode) {
+	if tn.IsEmpty() || c.name=="" { return }
+	qs := strings.ToLower(tn.Qualifier.String())
+	if strings.ToLower(tn.Name.String())!=c.name || (qs!="" && qs!=c.schema) { unknownTable(tn,ref) }
+}
 func (c *compiler) appendCols0(s sqlparser.Expr) {
 	restart:
 	switch v := s.(type) {
 	case *sqlparser.ParenExpr: s = v.Expr; goto restart
 	case *sqlparser.ColName:
+		c.checkTable(v.Qualifier,v)
 		if i,ok := c.tm[strings.ToLower(v.Name.String())]; ok {
 			c.cols = append(c.cols,i)
 		} else {
@@ -312,6 +492,7 @@ func (c *compiler) getColumn(s sqlparser.Expr) int {
 	switch v := s.(type) {
 	case *sqlparser.ParenExpr: s = v.Expr; goto restart
 	case *sqlparser.ColName:
+		c.checkTable(v.Qualifier,v)
 		if i,ok := c.tm[strings.ToLower(v.Name.String())]; ok {
 			return i
 		} else {
@@ -320,76 +501,317 @@ func (c *compiler) getColumn(s sqlparser.Expr) int {
 	}
 	panic("invalid column expression: << "+sqlparser.String(s)+" >>")
 }
+func unparen(expr sqlparser.Expr) sqlparser.Expr {
+	for {
+		p,ok := expr.(*sqlparser.ParenExpr)
+		if !ok { return expr }
+		expr = p.Expr
+	}
+}
+
+// Returns the result column name of a select expression.
+func colName(v *sqlparser.AliasedExpr) string {
+	if !v.As.IsEmpty() { return v.As.String() }
+	if cn,ok := unparen(v.Expr).(*sqlparser.ColName); ok { return cn.Name.String() }
+	return sqlparser.String(v.Expr)
+}
+
+// Returns the column index of an expression in the current mode.
+func (c *compiler) column(s sqlparser.Expr) int {
+	switch {
+	case c.having: return c.aggColumn(s)
+	case c.local!=nil:
+		src,i := c.resolve(s)
+		if src!=c.local { panic("column of another table: "+sqlparser.String(s)) }
+		return i
+	case c.srcs!=nil: return c.position(s)
+	}
+	return c.getColumn(s)
+}
+
+// Returns the position of a column in the input row (see Query).
+func (c *compiler) inputPos(s sqlparser.Expr) int {
+	if c.srcs!=nil { return c.position(s) }
+	return c.scanPos(c.getColumn(s))
+}
+func (c *compiler) isColumn(expr sqlparser.Expr) bool {
+	switch v := unparen(expr).(type) {
+	case *sqlparser.ColName: return true
+	case *sqlparser.FuncExpr: return c.having && isAggregate(v)
+	}
+	return false
+}
+
 func (c *compiler) appendCols(s sqlparser.SelectExpr) {
+	if c.srcs!=nil {
+		c.appendJoined(s)
+		return
+	}
 	switch v := s.(type) {
 	case *sqlparser.StarExpr:
-		for i := range c.t.Columns() {
+		c.checkTable(v.TableName,v)
+		for i,n := range c.t.Columns() {
 			c.cols = append(c.cols,i)
+			c.names = append(c.names,n)
+			c.exprs = append(c.exprs,&table.Expression{Op:table.E_COLUMN,Index:i})
 		}
 	case *sqlparser.AliasedExpr:
-		c.appendCols0(v.Expr)
+		if _,ok := unparen(v.Expr).(*sqlparser.ColName); ok {
+			c.appendCols0(v.Expr)
+			c.exprs = append(c.exprs,&table.Expression{Op:table.E_COLUMN,Index:c.cols[len(c.cols)-1]})
+		} else {
+			c.exprs = append(c.exprs,c.computed(v.Expr))
+		}
+		c.names = append(c.names,colName(v))
 	default:
 		panic("invalid select expression: << "+sqlparser.String(s)+" >>")
 	}
 }
+// The operator with swapped operands: "a < b" becomes "b > a".
+var flipOperator = map[string]string{
+	sqlparser.EqualStr:         sqlparser.EqualStr,
+	sqlparser.NullSafeEqualStr: sqlparser.NullSafeEqualStr,
+	sqlparser.NotEqualStr:      sqlparser.NotEqualStr,
+	sqlparser.LessThanStr:      sqlparser.GreaterThanStr,
+	sqlparser.LessEqualStr:     sqlparser.GreaterEqualStr,
+	sqlparser.GreaterThanStr:   sqlparser.LessThanStr,
+	sqlparser.GreaterEqualStr:  sqlparser.LessEqualStr,
+}
+
+// Returns the values of a list of constants (or placeholders), if it is one.
+func (c *compiler) list(expr sqlparser.Expr) (interface{},bool) {
+	switch v := expr.(type) {
+	case sqlparser.ValTuple:
+		l := make([]interface{},len(v))
+		for i,e := range v {
+			var ok bool
+			if l[i],ok = c.constant(e); !ok { return nil,false }
+		}
+		return l,true
+	case sqlparser.ListArg: return resolveValue(v),true
+	}
+	return nil,false
+}
+
+// Converts a column predicate into a ColumnFilter, if it is one.
+func (c *compiler) toFilter(expr sqlparser.Expr) (f table.ColumnFilter,ok bool) {
+	switch v := expr.(type) {
+	case *sqlparser.ComparisonExpr:
+		l,r,op := v.Left,v.Right,v.Operator
+		if !c.isColumn(l) && c.isColumn(r) {
+			if op,ok = flipOperator[op]; !ok { return }
+			l,r = r,l
+		}
+		if !c.isColumn(l) { return }
+		switch op {
+		case sqlparser.JSONExtractOp,sqlparser.JSONUnquoteExtractOp:
+			panic("unsupported operator: "+op)
+		}
+		switch op {
+		case sqlparser.InStr,sqlparser.NotInStr: f.Value,ok = c.list(r)
+		default: f.Value,ok = c.constant(r)
+		}
+		if !ok { return }
+		if f.Escape,ok = c.constant(v.Escape); !ok { return }
+		f.Index = c.column(l)
+		f.Operator = op
+		return f,true
+	case *sqlparser.IsExpr:
+		if !c.isColumn(v.Expr) { return }
+		f.Index = c.column(v.Expr)
+		f.Operator = v.Operator
+		return f,true
+	}
+	return
+}
+
+// Returns the bounds of a BETWEEN on a column, if it is one.
+func (c *compiler) rangeFilter(v *sqlparser.RangeCond) (i int,from,to interface{},ok bool) {
+	if !c.isColumn(v.Left) { return }
+	if from,ok = c.constant(v.From); !ok { return }
+	if to,ok = c.constant(v.To); !ok { return }
+	i = c.column(v.Left)
+	return
+}
+
+func mkPredicate(op table.PredicateOp,args ...*table.Predicate) *table.Predicate {
+	return &table.Predicate{Op:op,Args:args}
+}
+
+// Converts a where clause into a predicate tree.
+func (c *compiler) predicate(expr sqlparser.Expr) *table.Predicate {
+	switch v := expr.(type) {
+	case *sqlparser.ParenExpr: return c.predicate(v.Expr)
+	case *sqlparser.AndExpr: return mkPredicate(table.P_AND,c.predicate(v.Left),c.predicate(v.Right))
+	case *sqlparser.OrExpr: return mkPredicate(table.P_OR,c.predicate(v.Left),c.predicate(v.Right))
+	case *sqlparser.NotExpr: return mkPredicate(table.P_NOT,c.predicate(v.Expr))
+	case sqlparser.BoolVal:
+		if v { return mkPredicate(table.P_AND) }
+		return mkPredicate(table.P_OR)
+	case *sqlparser.RangeCond:
+		i,from,to,ok := c.rangeFilter(v)
+		if !ok { break }
+		f := &table.Predicate{Op:table.P_FILTER,Filter:table.ColumnFilter{Index:i,Operator:">=",Value:from}}
+		t := &table.Predicate{Op:table.P_FILTER,Filter:table.ColumnFilter{Index:i,Operator:"<=",Value:to}}
+		if v.Operator==sqlparser.NotBetweenStr {
+			f.Filter.Operator,t.Filter.Operator = "<",">"
+			return mkPredicate(table.P_OR,f,t)
+		}
+		return mkPredicate(table.P_AND,f,t)
+	}
+	if f,ok := c.toFilter(expr); ok { return &table.Predicate{Op:table.P_FILTER,Filter:f} }
+	return &table.Predicate{Op:table.P_EXPR,Expr:c.expr(expr)}
+}
+
+/*
+Adds a where clause to the scan. Top-level conjunctions of column predicates
+go to TableScan.Filter, anything else to the predicate tree TableScan.Where.
+*/
 func (c *compiler) addFilter(expr sqlparser.Expr) {
 	switch v := expr.(type) {
 	case *sqlparser.ParenExpr:
 		c.addFilter(v.Expr)
+		return
 	case *sqlparser.AndExpr:
 		c.addFilter(v.Left)
 		c.addFilter(v.Right)
-	case *sqlparser.ComparisonExpr:
-		{
-			i := c.getColumn(v.Left)
-			r := resolveValue(v.Right)
-			e := resolveValue(v.Escape)
-			c.scan.Filter = append(c.scan.Filter,table.ColumnFilter{i,v.Operator,r,e})
-		}
+		return
 	case *sqlparser.RangeCond:
-		{
-			b,e := ">=","<="
-			if v.Operator==sqlparser.NotBetweenStr { b,e = "<",">" }
-			i := c.getColumn(v.Left)
-			f := resolveValue(v.From)
-			t := resolveValue(v.To)
-			c.scan.Filter = append(c.scan.Filter,table.ColumnFilter{i,b,f,nil},table.ColumnFilter{i,e,t,nil})
+		if i,f,t,ok := c.rangeFilter(v); ok && v.Operator==sqlparser.BetweenStr {
+			c.scan.Filter = append(c.scan.Filter,table.ColumnFilter{i,">=",f,nil},table.ColumnFilter{i,"<=",t,nil})
+			return
 		}
+	case sqlparser.BoolVal:
+		if v { return }
+	}
+	if f,ok := c.toFilter(expr); ok {
+		c.scan.Filter = append(c.scan.Filter,f)
+		return
+	}
+	p := c.predicate(expr)
+	switch {
+	case c.scan.Where==nil: c.scan.Where = p
+	case c.scan.Where.Op==table.P_AND: c.scan.Where.Args = append(c.scan.Where.Args,p)
+	default: c.scan.Where = mkPredicate(table.P_AND,c.scan.Where,p)
 	}
 }
 func (c *compiler) addOrder(o *sqlparser.Order) {
+	if c.srcs!=nil {
+		c.order = append(c.order,table.ColumnOrder{c.position(o.Expr),o.Direction==sqlparser.DescScr})
+		return
+	}
 	i := c.getColumn(o.Expr)
 	c.scan.Order = append(c.scan.Order,table.ColumnOrder{i,o.Direction==sqlparser.DescScr})
 }
 
 func (c *compiler) addLimit(l *sqlparser.Limit) {
-	if l!=nil {
-		panic("not supported: limit")
-	}
+	if l==nil { return }
+	c.scan.Limit = resolveValue(l.Rowcount)
+	c.scan.Offset = resolveValue(l.Offset)
 }
 func (c *compiler) compileSel(s *sqlparser.Select) {
 	c.scan = new(table.TableScan)
-	if len(s.From)!=1 { panic("invalid table expression: << "+sqlparser.String(s.From)+" >>") }
-	if len(s.GroupBy)!=0 { panic("unsupported group_by") }
-	c.setTable(s.From[0])
-	for _,expr := range s.SelectExprs {
-		c.appendCols(expr)
+	if isJoin(s.From) {
+		for _,expr := range s.From { c.addFrom(expr) }
+	} else {
+		c.setTable(s.From[0])
 	}
-	if s.Where!=nil { c.addFilter(s.Where.Expr) }
-	if s.Having!=nil { c.addFilter(s.Having.Expr) }
-	for _,o := range s.OrderBy { c.addOrder(o) }
+	if len(s.GroupBy)!=0 || s.Having!=nil || s.Distinct!="" || hasAggregates(s.SelectExprs) {
+		c.compileAgg(s)
+	} else {
+		for _,expr := range s.SelectExprs {
+			c.appendCols(expr)
+		}
+		for _,o := range s.OrderBy { c.addOrder(o) }
+	}
+	if s.Where!=nil { c.addWhere(s.Where.Expr) }
 	
 	c.addLimit(s.Limit)
 }
 
-func (s *Schema) CompileSelect(q *sqlparser.Select) (t table.Table,cols []int, scan *table.TableScan, err error) {
+/*
+A compiled select statement. The table is scanned for the columns 'Cols'.
+If 'Agg' is nil, the scanned rows are the result, otherwise they are
+aggregated. 'Names' holds the names of the result columns.
+
+If there are 'Joins', the input row consists of the columns 'Cols' followed
+by the columns of each joined table. The joined rows are filtered by 'Where',
+and, unless aggregated, sorted by 'Order' and projected onto 'Output'. All of
+these refer to positions in the input row. Scan.Limit and Scan.Offset apply
+to the result rather than the table.
+
+If 'Exprs' is not nil, the result columns are computed by these expressions
+instead: Over the scanned row (columns 'Cols') or, with 'Joins', over the
+input row.
+*/
+type Query struct {
+	Table table.Table
+	Cols  []int
+	Scan  *table.TableScan
+	Names []string
+	Agg   *Aggregation
+	
+	Joins  []*Join
+	Where  *table.Predicate
+	Order  []table.ColumnOrder
+	Output []int
+	Exprs  []*table.Expression
+}
+
+func cloneExprs(exprs []*table.Expression) []*table.Expression {
+	if exprs==nil { return nil }
+	ne := make([]*table.Expression,len(exprs))
+	for i,e := range exprs { ne[i] = e.Clone() }
+	return ne
+}
+
+/*
+Returns a copy of the query, that shares no placeholders with 'q'. The
+tables and the column lists are shared.
+*/
+func (q *Query) Clone() *Query {
+	nq := *q
+	nq.Scan = q.Scan.Clone()
+	if q.Agg!=nil {
+		agg := *q.Agg
+		agg.Having = q.Agg.Having.Clone()
+		agg.Exprs = cloneExprs(q.Agg.Exprs)
+		nq.Agg = &agg
+	}
+	if q.Joins!=nil {
+		nq.Joins = make([]*Join,len(q.Joins))
+		for i,j := range q.Joins {
+			nj := *j
+			nj.Scan = j.Scan.Clone()
+			nj.On = j.On.Clone()
+			nq.Joins[i] = &nj
+		}
+	}
+	nq.Where = q.Where.Clone()
+	nq.Exprs = cloneExprs(q.Exprs)
+	return &nq
+}
+
+// Compiles a select statement.
+func (s *Schema) CompileQuery(q *sqlparser.Select) (query *Query,err error) {
 	defer func() { if r := recover(); r!=nil { err = any2err(r) } }()
 	c := new(compiler)
 	c.s = s
 	c.compileSel(q)
-	t = c.t
-	cols = c.cols
-	scan = c.scan
+	query = &Query{c.t,c.cols,c.scan,c.names,c.agg,c.joins,c.where,c.order,c.output,nil}
+	if c.isComputed && c.agg==nil { query.Exprs = c.exprs }
+	typeQuery(query)
+	return
+}
+
+// Compiles a select statement without aggregation. See also CompileQuery.
+func (s *Schema) CompileSelect(q *sqlparser.Select) (t table.Table,cols []int, scan *table.TableScan, err error) {
+	query,err := s.CompileQuery(q)
+	if err!=nil { return }
+	if query.Agg!=nil || len(query.Joins)!=0 || query.Exprs!=nil { err = fmt.Errorf("aggregation, joins and expressions not supported by CompileSelect, use CompileQuery"); return }
+	t = query.Table
+	cols = query.Cols
+	scan = query.Scan
 	return
 }
 
@@ -405,7 +827,11 @@ func (c *compiler) compileUpd(s *sqlparser.Update) {
 	c.updVals = make([]interface{},len(s.Exprs))
 	for i,upd := range s.Exprs {
 		c.updCols[i] = c.getColumn(upd.Name)
-		c.updVals[i] = resolveValue(upd.Expr)
+		if v,ok := c.constant(upd.Expr); ok {
+			c.updVals[i] = v
+		} else {
+			c.updVals[i] = c.expr(upd.Expr)
+		}
 	}
 	
 	c.addLimit(s.Limit)
@@ -447,6 +873,8 @@ func (s *Schema) CompileUpdate(dml *sqlparser.Update) (tab table.Table, job *tab
 	job.UpdCols = c.updCols
 	job.UpdVals = c.updVals
 	job.Scan = c.scan
+	typeScan(tab,job.Scan)
+	typeTuple(tab,job.UpdCols,job.UpdVals)
 	return
 }
 
@@ -464,5 +892,7 @@ func (s *Schema) CompileDelete(dml *sqlparser.Delete) (tab table.Table, job *tab
 	job.UpdCols = c.updCols
 	job.UpdVals = c.updVals
 	job.Scan = c.scan
+	typeScan(tab,job.Scan)
+	typeTuple(tab,job.UpdCols,job.UpdVals)
 	return
 }
@@ -24,6 +24,8 @@ SOFTWARE.
 package table
 
 import "fmt"
+import "context"
+import "reflect"
 
 func toString(i interface{}) string {
 	switch i.(type){
@@ -38,6 +40,11 @@ type ColumnFilter struct {
 	Operator string
 	Value,Escape interface{}
 }
+// Copies the filter, including a list value.
+func (c ColumnFilter) clone() ColumnFilter {
+	if l,ok := c.Value.([]interface{}); ok { c.Value = append([]interface{}(nil),l...) }
+	return c
+}
 func (c *ColumnFilter) Err(code ErrCode,cols []string) (se ScanError) {
 	se.ErrCode = code
 	se.Operator = c.Operator
@@ -83,9 +90,125 @@ func (c ColumnOrder) String() string {
 	return fmt.Sprintf("$%d %s",c.Index,s)
 }
 
+type PredicateOp int
+const (
+	P_FILTER PredicateOp = iota
+	P_AND
+	P_OR
+	P_NOT
+	P_EXPR
+)
+
+/*
+A node of a boolean predicate tree. P_FILTER nodes hold a ColumnFilter,
+P_AND and P_OR nodes hold any number of arguments and P_NOT nodes exactly
+one. An empty P_AND is true and an empty P_OR is false. P_EXPR nodes hold an
+Expression, that is true, if its value is a non-zero number or true.
+
+Predicates follow SQL's three-valued logic: Comparisons involving NULL are
+unknown, and a row is only selected, if the whole tree is true.
+*/
+type Predicate struct {
+	Op     PredicateOp
+	Filter ColumnFilter
+	Expr   *Expression
+	Args   []*Predicate
+}
+func (p *Predicate) String() string {
+	var op string
+	switch p.Op {
+	case P_FILTER: return p.Filter.String()
+	case P_EXPR: return p.Expr.String()
+	case P_NOT: return fmt.Sprintf("not %v",p.Args)
+	case P_AND: op = "and"
+	case P_OR: op = "or"
+	default: op = fmt.Sprintf("op_%d",int(p.Op))
+	}
+	return fmt.Sprintf("%s%v",op,p.Args)
+}
+
+// Returns a deep copy of the tree.
+func (p *Predicate) Clone() *Predicate {
+	if p==nil { return nil }
+	np := &Predicate{Op:p.Op,Filter:p.Filter.clone(),Expr:p.Expr.Clone()}
+	if p.Args!=nil {
+		np.Args = make([]*Predicate,len(p.Args))
+		for i,a := range p.Args { np.Args[i] = a.Clone() }
+	}
+	return np
+}
+
+// Calls 'f' on every ColumnFilter within the tree.
+func (p *Predicate) Walk(f func(cf *ColumnFilter)) {
+	if p==nil { return }
+	if p.Op==P_FILTER { f(&p.Filter) }
+	for _,a := range p.Args { a.Walk(f) }
+}
+
+// Calls 'f' on every node of the expressions within the tree.
+func (p *Predicate) WalkExpr(f func(e *Expression)) {
+	if p==nil { return }
+	if p.Op==P_EXPR { p.Expr.Walk(f) }
+	for _,a := range p.Args { a.WalkExpr(f) }
+}
+
+/*
+A table scan. The selected rows must satisfy every filter in 'Filter' (the
+AND-only fast path) and the predicate tree 'Where', if not nil.
+
+Callers must only pass a 'Where' predicate to a PredicateTable.
+*/
 type TableScan struct {
 	Filter []ColumnFilter
 	Order  []ColumnOrder
+	Where  *Predicate
+	
+	// The maximum number of rows and the number of rows to skip. Either
+	// is nil (no limit/offset) or an integer.
+	Limit,Offset interface{}
+}
+
+// Returns a deep copy of the scan.
+func (s *TableScan) Clone() *TableScan {
+	if s==nil { return nil }
+	ns := *s
+	if s.Filter!=nil {
+		ns.Filter = make([]ColumnFilter,len(s.Filter))
+		for i,f := range s.Filter { ns.Filter[i] = f.clone() }
+	}
+	ns.Order = append([]ColumnOrder(nil),s.Order...)
+	ns.Where = s.Where.Clone()
+	return &ns
+}
+
+var ErrInvalidLimit = fmt.Errorf("invalid limit/offset")
+
+func toCount(i interface{},def int64) (int64,error) {
+	var n int64
+	switch v := i.(type) {
+	case nil: return def,nil
+	case int64: n = v
+	case int: n = int64(v)
+	case int32: n = int64(v)
+	case uint64: n = int64(v)
+	case uint32: n = int64(v)
+	default: return 0,ErrInvalidLimit
+	}
+	if n<0 { return 0,ErrInvalidLimit }
+	return n,nil
+}
+
+// Returns the limit and the offset of the scan. A limit of -1 means unlimited.
+func (t *TableScan) LimitOffset() (limit,offset int64,err error) {
+	limit,err = toCount(t.Limit,-1)
+	if err!=nil { return }
+	offset,err = toCount(t.Offset,0)
+	return
+}
+
+// Returns true, if the scan has a limit or an offset.
+func (t *TableScan) HasLimit() bool {
+	return t.Limit!=nil || t.Offset!=nil
 }
 
 /*
@@ -116,6 +239,71 @@ type Table interface {
 	TableScan(cols []int,meta *TableScan) (TableIterator,error)
 }
 
+// The pushdown capabilities of a column.
+type ColumnCaps struct {
+	// The filter operators, that can be pushed down onto the column.
+	Operators []string
+	
+	// The orderings, that can be pushed down onto the column.
+	Asc,Desc bool
+}
+func (c *ColumnCaps) HasOperator(op string) bool {
+	for _,o := range c.Operators { if o==op { return true } }
+	return false
+}
+func (c *ColumnCaps) CanOrder(o *ColumnOrder) bool {
+	if o.Desc { return c.Desc }
+	return c.Asc
+}
+
+/*
+Optional interface for Table, that reports up front, which parts of a
+TableScan can be pushed down, so that the caller doesn't need to try and
+parse the ScanError.
+
+A TableScan, whose filters and orders are all covered by ScanCaps(), must
+be accepted by TableScan().
+*/
+type ScanCapableTable interface {
+	Table
+	
+	// Returns the capabilities of every column, in the order of Columns().
+	ScanCaps() []ColumnCaps
+}
+
+/*
+Splits the filters into those, 'caps' allows to be pushed down, and the
+residual ones.
+*/
+func SplitFilter(caps []ColumnCaps,filter []ColumnFilter) (pushed,residual []ColumnFilter) {
+	for _,f := range filter {
+		if f.Index<len(caps) && caps[f.Index].HasOperator(f.Operator) {
+			pushed = append(pushed,f)
+		} else {
+			residual = append(residual,f)
+		}
+	}
+	return
+}
+
+/*
+Optional interface for Table, used by EXPLAIN. Describes the access path,
+TableScan() would choose for 'meta', such as "full scan", "key seek" or
+"range scan".
+*/
+type ExplainingTable interface {
+	Table
+	ExplainScan(meta *TableScan) string
+}
+
+// Optional interface for Table: TableScan() evaluates TableScan.Where.
+type PredicateTable interface {
+	Table
+	ScanPredicates() bool
+}
+
+var ErrPredicateUnsupp = fmt.Errorf("where: predicate tree not supported")
+
 type TableIterator interface {
 	Close() error
 	// Scan the next row. Return nil on success, io.EOF on end-of-table
@@ -123,6 +311,19 @@ type TableIterator interface {
 	Next(cols []int,vals []interface{}) error
 }
 
+/*
+Optional interface for TableIterator. If LimitApplied() returns true, the
+iterator has applied TableScan.Limit and TableScan.Offset itself, otherwise
+the caller must do so.
+
+Implementations of UpdateableTable must either apply the Limit and Offset
+of TableUpdate.Scan or reject it.
+*/
+type LimitingIterator interface {
+	TableIterator
+	LimitApplied() bool
+}
+
 var ErrUnsupportedResult = fmt.Errorf("not supported result")
 
 type ModifyResult [2]*int64
@@ -137,6 +338,16 @@ func (r *ModifyResult) RowsAffected() (int64, error) {
 	return *(r[1]),nil
 }
 
+/*
+An insert. For T_Insert with OndupCols (ON DUPLICATE KEY UPDATE), a row,
+whose key exists, updates the existing row instead. An *Expression within
+OndupVals is evaluated over the existing row followed by the row to be
+inserted: Of a table with n columns, $i refers to column i of the existing
+row and $(n+i) to column i of the inserted row (VALUES(col)).
+
+The affected rows count MySQL-style: 1 per inserted row and 2 per updated
+row.
+*/
 type TableInsert struct {
 	AllCols bool
 	Cols []int
@@ -147,6 +358,41 @@ type TableInsert struct {
 	OndupCols []int
 	OndupVals []interface{}
 }
+// Returns a copy of the tuple with every *Expression cloned.
+func CloneTuple(tuple []interface{}) []interface{} {
+	if tuple==nil { return nil }
+	nt := make([]interface{},len(tuple))
+	for i,v := range tuple {
+		if e,ok := v.(*Expression); ok { v = e.Clone() }
+		nt[i] = v
+	}
+	return nt
+}
+
+// Returns a deep copy of the insert. The column lists are shared.
+func (ti *TableInsert) Clone() *TableInsert {
+	if ti==nil { return nil }
+	nti := *ti
+	if ti.Values!=nil {
+		nti.Values = make([][]interface{},len(ti.Values))
+		for i,t := range ti.Values { nti.Values[i] = CloneTuple(t) }
+	}
+	nti.OndupVals = CloneTuple(ti.OndupVals)
+	return &nti
+}
+/*
+Optional interface for Table, that generates the values of a column. An
+insert, that omits the column AutoIncrementColumn() or sets it to NULL (or
+0), generates its value. The ModifyResult of such an insert reports the
+first generated value as LastInsertId.
+*/
+type AutoIncrementTable interface {
+	Table
+	
+	// Returns the index of the generated column, or -1.
+	AutoIncrementColumn() int
+}
+
 type TableInsertStmt interface {
 	Close() error
 	Abort() error
@@ -164,10 +410,20 @@ type TableUpdate struct {
 	Op  TableOp
 	Scan *TableScan
 	
+	// The new values. An *Expression is evaluated over the old row.
 	UpdCols []int
 	UpdVals []interface{}
 }
 
+// Returns a deep copy of the update. The column list is shared.
+func (tu *TableUpdate) Clone() *TableUpdate {
+	if tu==nil { return nil }
+	ntu := *tu
+	ntu.Scan = tu.Scan.Clone()
+	ntu.UpdVals = CloneTuple(tu.UpdVals)
+	return &ntu
+}
+
 type TableUpdateStmt interface {
 	Close() error
 	Abort() error
@@ -181,6 +437,104 @@ type UpdateableTable interface {
 	TablePrepareUpdate(tu *TableUpdate) (TableUpdateStmt,error)
 }
 
+// The type of a column.
+type ColumnType struct {
+	// The Go type of the values. Nil if unknown.
+	ScanType reflect.Type
+	
+	// The SQL type name, like "BIGINT". Empty if unknown.
+	DatabaseTypeName string
+	
+	// Whether the column may contain NULL, if known.
+	Nullable,NullableKnown bool
+}
+
+// Optional interface for Table, that reports the types of its columns.
+type TypedTable interface {
+	Table
+	
+	// One ColumnType per column of Columns().
+	ColumnTypes() []ColumnType
+}
+
+/*
+Optional interface for Table, whose scans can be cancelled. Once 'ctx' is
+done, the returned iterator must fail with ctx.Err().
+*/
+type ContextScanTable interface {
+	Table
+	
+	TableScanContext(ctx context.Context,cols []int,meta *TableScan) (TableIterator,error)
+}
+
+// Optional interface for TableIterator. See ContextScanTable.
+type ContextIterator interface {
+	TableIterator
+	
+	NextContext(ctx context.Context,cols []int,vals []interface{}) error
+}
+
+/*
+Optional interface for TableInsertStmt. The insert stops with ctx.Err(), once
+'ctx' is done. If the statement owns its transaction, it is rolled back.
+*/
+type ContextInsertStmt interface {
+	TableInsertStmt
+	
+	TableInsertContext(ctx context.Context,ti *TableInsert) (*ModifyResult,error)
+}
+
+/*
+Optional interface for TableUpdateStmt. The update stops with ctx.Err(), once
+'ctx' is done. If the statement owns its transaction, it is rolled back.
+*/
+type ContextUpdateStmt interface {
+	TableUpdateStmt
+	
+	TableUpdateContext(ctx context.Context,tu *TableUpdate) (*ModifyResult,error)
+}
+
+// A transaction spanning multiple statements.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+/*
+This interface represents a Table, whose statements can be bound to one
+transaction spanning multiple statements.
+
+Tables returning the same value from TxResource() share their transaction.
+Every view returned by WithTx() must see the modifications done through other
+views of the same transaction (read-your-writes).
+
+	var tab table.TransactionalTable
+	tx,_ := tab.TxBegin(true)
+	view,_ := tab.WithTx(tx)
+	
+	iter,_ := view.TableScan(cols,new(table.TableScan))
+	...
+	tx.Commit()
+*/
+type TransactionalTable interface {
+	Table
+	
+	// Returns a comparable value identifying the underlying resource,
+	// eg. the database handle.
+	TxResource() interface{}
+	
+	// Begins a new transaction on the underlying resource.
+	TxBegin(writable bool) (Tx,error)
+	
+	// Returns a view of this table, that operates within 'tx'. The
+	// transaction must have been returned by TxBegin() of a table with
+	// the same TxResource().
+	//
+	// Statements and iterators of the view must neither commit nor
+	// rollback 'tx' on Close() or Abort().
+	WithTx(tx Tx) (Table,error)
+}
+
 type TableOp int
 const (
 	// Insert Job
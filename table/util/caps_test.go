@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package util_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/util"
+)
+
+// A restricted table, that declares its capabilities.
+type capsTable struct{ *restricted }
+
+func (t capsTable) ScanCaps() []table.ColumnCaps {
+	return []table.ColumnCaps{{Operators: []string{"="}}, {}, {}}
+}
+
+func TestSplitScan(t *testing.T) {
+	tab := capsTable{new(restricted)}
+	where := &table.Predicate{Op: table.P_FILTER, Filter: table.ColumnFilter{Index: 2, Operator: "<", Value: int64(5)}}
+	meta := &table.TableScan{
+		Filter: []table.ColumnFilter{
+			{Index: 0, Operator: "=", Value: int64(1)},
+			{Index: 1, Operator: "like", Value: "a%"},
+			{Index: 0, Operator: ">", Value: int64(0)},
+		},
+		Where: where,
+	}
+	pushed, residual, w := util.SplitScan(tab, meta)
+	if len(pushed.Filter) != 1 || pushed.Filter[0].Operator != "=" {
+		t.Errorf("pushed: %v", pushed.Filter)
+	}
+	if len(residual) != 2 || residual[0].Index != 1 || residual[1].Operator != ">" {
+		t.Errorf("residual: %v", residual)
+	}
+	if pushed.Where != nil || w != where {
+		t.Errorf("where: pushed %v, residual %v", pushed.Where, w)
+	}
+	if len(meta.Filter) != 3 {
+		t.Errorf("the scan was modified: %v", meta.Filter)
+	}
+}
+
+// A table, that declares its capabilities, is scanned once, with the filters it accepts.
+func TestCapsScan(t *testing.T) {
+	tab := capsTable{new(restricted)}
+	meta := &table.TableScan{Filter: []table.ColumnFilter{
+		{Index: 2, Operator: ">", Value: int64(4)},
+		{Index: 0, Operator: "=", Value: int64(2)},
+	}}
+	it, err := util.ResidualScan(tab, []int{1}, meta)
+	if got := names(t, it, err); !reflect.DeepEqual(got, []string{"banana"}) {
+		t.Errorf("got %v", got)
+	}
+	if len(tab.scans) != 1 || len(tab.scans[0].Filter) != 1 || tab.scans[0].Filter[0].Index != 0 {
+		t.Errorf("scans: %v", tab.scans)
+	}
+}
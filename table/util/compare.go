@@ -0,0 +1,126 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tsFormat   = "2006-01-02 15:04:05.999999999"
+	dateFormat = "2006-01-02"
+)
+
+// Parses a SQL-Timestamp or SQL-Date.
+func ParseTime(s string) (time.Time,error) {
+	s = strings.TrimSpace(s)
+	if t,err := time.Parse(tsFormat,s); err==nil { return t,nil }
+	return time.Parse(dateFormat,s)
+}
+
+func asNumber(i interface{}) (f float64,isInt bool,n int64,ok bool) {
+	switch v := i.(type) {
+	case int64: return float64(v),true,v,true
+	case float64: return v,false,0,true
+	case bool:
+		if v { return 1,true,1,true }
+		return 0,true,0,true
+	}
+	return
+}
+func asText(i interface{}) ([]byte,bool) {
+	switch v := i.(type) {
+	case string: return []byte(v),true
+	case []byte: return v,true
+	}
+	return nil,false
+}
+
+func cmpInt(a,b int64) int {
+	switch {
+	case a<b: return -1
+	case a>b: return 1
+	}
+	return 0
+}
+func cmpFloat(a,b float64) int {
+	switch {
+	case a<b: return -1
+	case a>b: return 1
+	}
+	return 0
+}
+
+/*
+Compares two non-NULL values, following MySQL's rules loosely: Numbers are
+compared numerically, strings are converted to numbers if compared with a
+number, and to timestamps if compared with a timestamp.
+
+Returns -1, 0 or 1.
+*/
+func Compare(a,b interface{}) (int,error) {
+	af,ai,an,aok := asNumber(a)
+	bf,bi,bn,bok := asNumber(b)
+	at,atok := asText(a)
+	bt,btok := asText(b)
+	switch {
+	case aok && bok:
+		if ai && bi { return cmpInt(an,bn),nil }
+		return cmpFloat(af,bf),nil
+	case atok && btok:
+		return bytes.Compare(at,bt),nil
+	case aok && btok:
+		f,err := strconv.ParseFloat(strings.TrimSpace(string(bt)),64)
+		if err!=nil { return 0,fmt.Errorf("cannot compare %v with %q",a,bt) }
+		return cmpFloat(af,f),nil
+	case atok && bok:
+		f,err := strconv.ParseFloat(strings.TrimSpace(string(at)),64)
+		if err!=nil { return 0,fmt.Errorf("cannot compare %q with %v",at,b) }
+		return cmpFloat(f,bf),nil
+	}
+	if ta,ok := a.(time.Time); ok {
+		tb,ok := b.(time.Time)
+		if !ok && btok {
+			var err error
+			tb,err = ParseTime(string(bt))
+			if err!=nil { return 0,err }
+			ok = true
+		}
+		if ok {
+			switch {
+			case ta.Before(tb): return -1,nil
+			case ta.After(tb): return 1,nil
+			}
+			return 0,nil
+		}
+	} else if _,ok := b.(time.Time); ok && atok {
+		c,err := Compare(b,a)
+		return -c,err
+	}
+	return 0,fmt.Errorf("cannot compare %T with %T",a,b)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package util
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"context"
+)
+
+// Checks the context before every row.
+type contextIterator struct {
+	table.TableIterator
+	ctx context.Context
+}
+func (c *contextIterator) Next(cols []int,vals []interface{}) error {
+	if ci,ok := c.TableIterator.(table.ContextIterator); ok { return ci.NextContext(c.ctx,cols,vals) }
+	if err := c.ctx.Err(); err!=nil { return err }
+	return c.TableIterator.Next(cols,vals)
+}
+func (c *contextIterator) LimitApplied() bool {
+	li,ok := c.TableIterator.(table.LimitingIterator)
+	return ok && li.LimitApplied()
+}
+
+/*
+Performs a table scan, that stops with ctx.Err(), once 'ctx' is done. Tables,
+that don't implement table.ContextScanTable, are checked before every row.
+*/
+func ScanContext(ctx context.Context,tab table.Table,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	if ct,ok := tab.(table.ContextScanTable); ok { return ct.TableScanContext(ctx,cols,meta) }
+	if err := ctx.Err(); err!=nil { return nil,err }
+	iter,err := tab.TableScan(cols,meta)
+	if err!=nil || ctx.Done()==nil { return iter,err }
+	return &contextIterator{iter,ctx},nil
+}
+
+// Calls TableInsertContext, if implemented, and TableInsert otherwise.
+func InsertContext(ctx context.Context,stmt table.TableInsertStmt,ti *table.TableInsert) (*table.ModifyResult,error) {
+	if cs,ok := stmt.(table.ContextInsertStmt); ok { return cs.TableInsertContext(ctx,ti) }
+	if err := ctx.Err(); err!=nil { return nil,err }
+	return stmt.TableInsert(ti)
+}
+
+// Calls TableUpdateContext, if implemented, and TableUpdate otherwise.
+func UpdateContext(ctx context.Context,stmt table.TableUpdateStmt,tu *table.TableUpdate) (*table.ModifyResult,error) {
+	if cs,ok := stmt.(table.ContextUpdateStmt); ok { return cs.TableUpdateContext(ctx,tu) }
+	if err := ctx.Err(); err!=nil { return nil,err }
+	return stmt.TableUpdate(tu)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package util
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tsFormat1  = "2006-01-02 15:04:05"
+	timeFormat = "15:04:05"
+)
+
+func parseInt(s string,unsigned bool) (int64,error) {
+	s = strings.TrimSpace(s)
+	if unsigned {
+		u,err := strconv.ParseUint(s,10,64)
+		if err==nil { return int64(u),nil }
+	} else {
+		i,err := strconv.ParseInt(s,10,64)
+		if err==nil { return i,nil }
+	}
+	f,err := strconv.ParseFloat(s,64)
+	if err!=nil { return 0,err }
+	return int64(f),nil
+}
+
+/*
+Converts a value into the SQL type 'typ', as in CAST(v AS typ). The types
+are "signed" and "unsigned" (int64), "decimal" (float64), "binary" ([]byte),
+"char" (string), and "date", "time" and "datetime" (time.Time).
+
+NULL is converted into the zero value of the type.
+See http://www.mysqltutorial.org/mysql-cast/
+*/
+func Convert(i interface{},typ string) (interface{},error) {
+	switch typ {
+	// int64
+	case "signed","unsigned":
+		switch v := i.(type) {
+		case nil: return int64(0),nil
+		case int64: return i,nil
+		case float64: return int64(v),nil
+		case bool: if v { return int64(1),nil } else { return int64(0),nil }
+		case string: return parseInt(v,typ=="unsigned")
+		case []byte: return parseInt(string(v),typ=="unsigned")
+		}
+	// float64
+	case "decimal":
+		switch v := i.(type) {
+		case nil: return float64(0),nil
+		case int64: return float64(v),nil
+		case float64: return i,nil
+		case bool: if v { return float64(1),nil } else { return float64(0),nil }
+		case string: return strconv.ParseFloat(strings.TrimSpace(v),64)
+		case []byte: return strconv.ParseFloat(strings.TrimSpace(string(v)),64)
+		}
+	// []byte
+	case "binary":
+		switch v := i.(type) {
+		case nil: return []byte(nil),nil
+		case []byte: return i,nil
+		case time.Time: return v.AppendFormat(make([]byte,0,len(tsFormat)),tsFormat),nil
+		}
+		s,err := Convert(i,"char")
+		if err!=nil { return nil,err }
+		return []byte(s.(string)),nil
+	// string
+	case "char":
+		switch v := i.(type) {
+		case nil: return "",nil
+		case int64: return strconv.FormatInt(v,10),nil
+		case float64: return strconv.FormatFloat(v,'f',-1,64),nil
+		case bool: if v { return "true",nil } else { return "false",nil }
+		case []byte: return string(v),nil
+		case string: return i,nil
+		case time.Time: return v.Format(tsFormat),nil
+		}
+	// time.Time
+	case "time","date","datetime":
+		s := ""
+		switch v := i.(type) {
+		case nil: return time.Time{},nil
+		case time.Time: return v,nil
+		case []byte: s = string(v)
+		case string: s = v
+		default: goto done
+		}
+		if s == "" { return time.Time{},nil }
+		switch typ {
+		case "datetime":
+			tm,err := time.Parse(tsFormat,s)
+			if err==nil { return tm,nil }
+			return time.Parse(tsFormat1,s)
+		case "date":
+			return time.Parse(dateFormat,s)
+		}
+		return time.Parse(timeFormat,s)
+	}
+	
+	done:
+	return nil,fmt.Errorf("cant convert %T(%v) into %s",i,i,typ)
+}
+
+// Formats a value as SQL literal for error messages.
+func literal(i interface{}) string {
+	switch v := i.(type) {
+	case string: return "'"+strings.Replace(v,"'","''",-1)+"'"
+	case []byte: return literal(string(v))
+	case time.Time: return literal(v.Format(tsFormat))
+	}
+	return fmt.Sprint(i)
+}
+
+/*
+Converts a value into the type of a column, before it is bound to a
+placeholder. Unlike Convert, it rejects lossy conversions, such as 'abc'
+or 1.5 into an integer. NULL, and values for columns of unknown type, are
+returned as is.
+*/
+func Coerce(i interface{},typ *table.ColumnType) (interface{},error) {
+	if i==nil || typ==nil { return i,nil }
+	vt,ok := ValueTypeOf(typ.ScanType)
+	if !ok { return i,nil }
+	var v interface{}
+	var err error
+	switch vt {
+	case VT_INT:
+		switch x := i.(type) {
+		case int64: v = x
+		case float64: if x==math.Trunc(x) && math.Abs(x)<1<<63 { v = int64(x) }
+		case bool: if x { v = int64(1) } else { v = int64(0) }
+		case string: v,err = strconv.ParseInt(strings.TrimSpace(x),10,64)
+		case []byte: v,err = strconv.ParseInt(strings.TrimSpace(string(x)),10,64)
+		}
+	case VT_FLOAT:
+		switch x := i.(type) {
+		case int64: v = float64(x)
+		case float64: v = x
+		case bool: if x { v = float64(1) } else { v = float64(0) }
+		case string: v,err = strconv.ParseFloat(strings.TrimSpace(x),64)
+		case []byte: v,err = strconv.ParseFloat(strings.TrimSpace(string(x)),64)
+		}
+	case VT_BOOL:
+		switch x := i.(type) {
+		case bool: v = x
+		case int64: v = x!=0
+		case string: v,err = strconv.ParseBool(strings.TrimSpace(x))
+		case []byte: v,err = strconv.ParseBool(strings.TrimSpace(string(x)))
+		}
+	case VT_BYTES:
+		switch x := i.(type) {
+		case []byte: v = x
+		case string: v = []byte(x)
+		}
+	case VT_STRING:
+		switch i.(type) {
+		case string: v = i
+		case []byte,int64,float64: v,err = Convert(i,"char")
+		}
+	case VT_TIMESTAMP:
+		switch i.(type) {
+		case time.Time: v = i
+		case string,[]byte:
+			v,err = Convert(i,"datetime")
+			if err!=nil { v,err = Convert(i,"date") }
+		}
+	}
+	if v==nil || err!=nil {
+		n := typ.DatabaseTypeName
+		if n=="" { n = vt.DatabaseTypeName() }
+		return nil,fmt.Errorf("cannot convert %s to %s",literal(i),n)
+	}
+	return v,nil
+}
@@ -0,0 +1,299 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package util
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Returns the numeric value of a non-NULL operand. Strings are parsed.
+func toNumber(i interface{}) (f float64,isInt bool,n int64,err error) {
+	var ok bool
+	if f,isInt,n,ok = asNumber(i); ok { return }
+	if t,ok := asText(i); ok {
+		s := strings.TrimSpace(string(t))
+		if n,err = strconv.ParseInt(s,10,64); err==nil { return float64(n),true,n,nil }
+		f,err = strconv.ParseFloat(s,64)
+		if err!=nil { err = fmt.Errorf("not a number: %q",t) }
+		return
+	}
+	err = fmt.Errorf("not a number: %T",i)
+	return
+}
+
+// Returns the truth value of 'v': tNull for NULL, tTrue for non-zero numbers.
+func truth(v interface{}) (int8,error) {
+	if v==nil { return tNull,nil }
+	f,_,_,err := toNumber(v)
+	if err!=nil { return tFalse,err }
+	return tri(f!=0),nil
+}
+func fromTri(t int8) interface{} {
+	switch t {
+	case tTrue: return true
+	case tFalse: return false
+	}
+	return nil
+}
+
+func arith(op string,a,b interface{}) (interface{},error) {
+	af,ai,an,err := toNumber(a)
+	if err!=nil { return nil,err }
+	bf,bi,bn,err := toNumber(b)
+	if err!=nil { return nil,err }
+	ints := ai && bi
+	switch op {
+	case "+":
+		if ints { return an+bn,nil }
+		return af+bf,nil
+	case "-":
+		if ints { return an-bn,nil }
+		return af-bf,nil
+	case "*":
+		if ints { return an*bn,nil }
+		return af*bf,nil
+	case "/":
+		if bf==0 { return nil,nil }
+		return af/bf,nil
+	case "div":
+		if !ints { an,bn = int64(af),int64(bf) }
+		if bn==0 { return nil,nil }
+		return an/bn,nil
+	case "%","mod":
+		if ints {
+			if bn==0 { return nil,nil }
+			return an%bn,nil
+		}
+		if bf==0 { return nil,nil }
+		return math.Mod(af,bf),nil
+	}
+	if !ints { an,bn = int64(af),int64(bf) }
+	switch op {
+	case "&": return an&bn,nil
+	case "|": return an|bn,nil
+	case "^": return an^bn,nil
+	case "<<": return int64(uint64(an)<<uint64(bn)),nil
+	case ">>": return int64(uint64(an)>>uint64(bn)),nil
+	}
+	return nil,fmt.Errorf("unsupported operator: %s",op)
+}
+
+// Evaluates an expression over a row, that holds the columns 'cols'.
+func (m *Matcher) Eval(e *table.Expression,cols []int,vals []interface{}) (interface{},error) {
+	switch e.Op {
+	case table.E_VALUE: return e.Value,nil
+	case table.E_COLUMN:
+		i := indexOf(cols,e.Index)
+		if i<0 { return nil,fmt.Errorf("column $%d not available",e.Index) }
+		return vals[i],nil
+	case table.E_UNARY:
+		v,err := m.Eval(e.Args[0],cols,vals)
+		if err!=nil { return nil,err }
+		switch e.Operator {
+		case "+": return v,nil
+		case "!":
+			t,err := truth(v)
+			if err!=nil { return nil,err }
+			switch t {
+			case tTrue: t = tFalse
+			case tFalse: t = tTrue
+			}
+			return fromTri(t),nil
+		case "-","~":
+			if v==nil { return nil,nil }
+			f,isInt,n,err := toNumber(v)
+			if err!=nil { return nil,err }
+			switch {
+			case e.Operator=="~" && isInt: return ^n,nil
+			case e.Operator=="~": return ^int64(f),nil
+			case isInt: return -n,nil
+			}
+			return -f,nil
+		}
+		t,err := m.match3(&table.ColumnFilter{Operator:e.Operator},v)
+		if err!=nil { return nil,err }
+		return fromTri(t),nil
+	case table.E_BINARY:
+		a,err := m.Eval(e.Args[0],cols,vals)
+		if err!=nil { return nil,err }
+		switch e.Operator {
+		case "and","or","xor": return m.logic(e,a,cols,vals)
+		}
+		b,err := m.Eval(e.Args[1],cols,vals)
+		if err!=nil { return nil,err }
+		if arithOps[e.Operator] {
+			if a==nil || b==nil { return nil,nil }
+			return arith(e.Operator,a,b)
+		}
+		t,err := m.match3(&table.ColumnFilter{Operator:e.Operator,Value:b,Escape:e.Value},a)
+		if err!=nil { return nil,err }
+		return fromTri(t),nil
+	case table.E_CASE:
+		n := len(e.Args)
+		var base interface{}
+		if e.Args[0]!=nil {
+			v,err := m.Eval(e.Args[0],cols,vals)
+			if err!=nil { return nil,err }
+			base = v
+		}
+		for i := 1; i+1<n; i += 2 {
+			w,err := m.Eval(e.Args[i],cols,vals)
+			if err!=nil { return nil,err }
+			var t int8
+			switch {
+			case e.Args[0]==nil: t,err = truth(w)
+			case base==nil || w==nil: t = tNull
+			default:
+				var c int
+				c,err = Compare(base,w)
+				t = tri(c==0)
+			}
+			if err!=nil { return nil,err }
+			if t==tTrue { return m.Eval(e.Args[i+1],cols,vals) }
+		}
+		if e.Args[n-1]==nil { return nil,nil }
+		return m.Eval(e.Args[n-1],cols,vals)
+	case table.E_FUNC:
+		f,ok := e.Value.(table.ScalarFunc)
+		if !ok { return nil,fmt.Errorf("unknown function: %s",e.Operator) }
+		args := make([]interface{},len(e.Args))
+		for i,a := range e.Args {
+			v,err := m.Eval(a,cols,vals)
+			if err!=nil { return nil,err }
+			args[i] = v
+		}
+		return f(args)
+	case table.E_CONVERT:
+		v,err := m.Eval(e.Args[0],cols,vals)
+		if err!=nil { return nil,err }
+		return Convert(v,e.Operator)
+	case table.E_LIST:
+		l := make([]interface{},len(e.Args))
+		for i,a := range e.Args {
+			v,err := m.Eval(a,cols,vals)
+			if err!=nil { return nil,err }
+			l[i] = v
+		}
+		return l,nil
+	}
+	return nil,fmt.Errorf("invalid expression %v",e)
+}
+
+var arithOps = map[string]bool{"+":true,"-":true,"*":true,"/":true,"div":true,"%":true,"mod":true,"&":true,"|":true,"^":true,"<<":true,">>":true}
+
+// Evaluates "and", "or" and "xor" in three-valued logic.
+func (m *Matcher) logic(e *table.Expression,a interface{},cols []int,vals []interface{}) (interface{},error) {
+	ta,err := truth(a)
+	if err!=nil { return nil,err }
+	switch {
+	case e.Operator=="and" && ta==tFalse: return false,nil
+	case e.Operator=="or" && ta==tTrue: return true,nil
+	}
+	b,err := m.Eval(e.Args[1],cols,vals)
+	if err!=nil { return nil,err }
+	tb,err := truth(b)
+	if err!=nil { return nil,err }
+	switch e.Operator {
+	case "and":
+		if tb==tFalse { return false,nil }
+		if ta==tNull || tb==tNull { return nil,nil }
+		return true,nil
+	case "or":
+		if tb==tTrue { return true,nil }
+		if ta==tNull || tb==tNull { return nil,nil }
+		return false,nil
+	}
+	if ta==tNull || tb==tNull { return nil,nil }
+	return ta!=tb,nil
+}
+
+/*
+Computes the new values of a table.TableUpdate for a row, storing them into
+'dst'. The row 'vals' holds the old values of the columns 'cols'. Expressions
+within UpdVals are evaluated over the old row.
+*/
+func (m *Matcher) UpdateValues(tu *table.TableUpdate,cols []int,vals []interface{},dst []interface{}) error {
+	for i,v := range tu.UpdVals {
+		if e,ok := v.(*table.Expression); ok {
+			r,err := m.Eval(e,cols,vals)
+			if err!=nil { return err }
+			v = r
+		}
+		dst[i] = v
+	}
+	return nil
+}
+
+/*
+Returns 'ti', or a copy of it, if its Values contain expressions, that holds
+their results instead. Such expressions (as NOW()) use no columns.
+*/
+func (m *Matcher) InsertValues(ti *table.TableInsert) (*table.TableInsert,error) {
+	var nti *table.TableInsert
+	for i,row := range ti.Values {
+		for j,v := range row {
+			e,ok := v.(*table.Expression)
+			if !ok { continue }
+			r,err := m.Eval(e,nil,nil)
+			if err!=nil { return nil,err }
+			if nti==nil {
+				c := *ti
+				c.Values = append([][]interface{}(nil),ti.Values...)
+				nti = &c
+			}
+			if &nti.Values[i][0]==&row[0] { nti.Values[i] = append([]interface{}(nil),row...) }
+			nti.Values[i][j] = r
+		}
+	}
+	if nti==nil { return ti,nil }
+	return nti,nil
+}
+
+/*
+Computes the ON DUPLICATE KEY UPDATE values of a table.TableInsert, storing
+them into 'dst'. 'old' is the existing row and 'ins' the row to be inserted,
+both holding every column of the table.
+*/
+func (m *Matcher) OndupValues(ti *table.TableInsert,old,ins []interface{},dst []interface{}) error {
+	var cols []int
+	var row []interface{}
+	for i,v := range ti.OndupVals {
+		if e,ok := v.(*table.Expression); ok {
+			if row==nil {
+				row = append(append(make([]interface{},0,len(old)+len(ins)),old...),ins...)
+				cols = make([]int,len(row))
+				for j := range cols { cols[j] = j }
+			}
+			r,err := m.Eval(e,cols,row)
+			if err!=nil { return err }
+			v = r
+		}
+		dst[i] = v
+	}
+	return nil
+}
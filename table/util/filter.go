@@ -0,0 +1,349 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+
+package util
+
+import (
+	"github.com/mad-day/db-utils/table"
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Matches 's' against a SQL LIKE pattern.
+func Like(s,pattern string,escape rune) bool {
+	return like([]rune(s),[]rune(pattern),escape)
+}
+func like(s,p []rune,escape rune) bool {
+	for len(p)!=0 {
+		switch {
+		case p[0]=='%':
+			for len(p)!=0 && p[0]=='%' { p = p[1:] }
+			if len(p)==0 { return true }
+			for i := range s {
+				if like(s[i:],p,escape) { return true }
+			}
+			return false
+		case p[0]=='_':
+			if len(s)==0 { return false }
+		case p[0]==escape && len(p)>1:
+			p = p[1:]
+			fallthrough
+		default:
+			if len(s)==0 || s[0]!=p[0] { return false }
+		}
+		s,p = s[1:],p[1:]
+	}
+	return len(s)==0
+}
+
+func toEscape(i interface{}) (rune,error) {
+	switch v := i.(type) {
+	case nil: return '\\',nil
+	case string: for _,r := range v { return r,nil }
+	case []byte: for _,r := range string(v) { return r,nil }
+	}
+	return 0,fmt.Errorf("invalid escape %v",i)
+}
+
+/*
+Evaluates table.ColumnFilter objects against column values, and expressions
+over rows (see Eval). The zero value is ready to use. A Matcher caches
+compiled regular expressions, and is not safe for concurrent use.
+*/
+type Matcher struct{
+	regexps map[string]*regexp.Regexp
+}
+func (m *Matcher) regexp(s string) (*regexp.Regexp,error) {
+	if re,ok := m.regexps[s]; ok { return re,nil }
+	re,err := regexp.Compile(s)
+	if err!=nil { return nil,err }
+	if m.regexps==nil { m.regexps = make(map[string]*regexp.Regexp) }
+	m.regexps[s] = re
+	return re,nil
+}
+
+// Three-valued logic.
+const (
+	tFalse int8 = iota
+	tTrue
+	tNull
+)
+func tri(b bool) int8 {
+	if b { return tTrue }
+	return tFalse
+}
+
+// Returns true, if 'v' satisfies the filter. Comparisons involving NULL are false.
+func (m *Matcher) Match(f *table.ColumnFilter,v interface{}) (bool,error) {
+	t,err := m.match3(f,v)
+	return t==tTrue,err
+}
+func (m *Matcher) match3(f *table.ColumnFilter,v interface{}) (int8,error) {
+	switch f.Operator {
+	case "is null": return tri(v==nil),nil
+	case "is not null": return tri(v!=nil),nil
+	case "is true","is not true","is false","is not false":
+		b := false
+		if v!=nil {
+			c,err := Compare(v,int64(0))
+			if err!=nil { return tFalse,err }
+			b = c!=0
+		}
+		switch f.Operator {
+		case "is true": return tri(v!=nil && b),nil
+		case "is not true": return tri(v==nil || !b),nil
+		case "is false": return tri(v!=nil && !b),nil
+		}
+		return tri(v==nil || b),nil
+	case "<=>":
+		if v==nil || f.Value==nil { return tri(v==nil && f.Value==nil),nil }
+		c,err := Compare(v,f.Value)
+		return tri(c==0),err
+	case "=","!=","<>","<","<=",">",">=":
+		if v==nil || f.Value==nil { return tNull,nil }
+		c,err := Compare(v,f.Value)
+		if err!=nil { return tFalse,err }
+		switch f.Operator {
+		case "=": return tri(c==0),nil
+		case "!=","<>": return tri(c!=0),nil
+		case "<": return tri(c<0),nil
+		case "<=": return tri(c<=0),nil
+		case ">": return tri(c>0),nil
+		}
+		return tri(c>=0),nil
+	case "like","not like":
+		if v==nil || f.Value==nil { return tNull,nil }
+		s,ok1 := asText(v)
+		p,ok2 := asText(f.Value)
+		if !ok1 { s = []byte(fmt.Sprint(v)) }
+		if !ok2 { return tFalse,f.Err(table.E_FILTER_OPERATOR_UNSUPP,nil) }
+		e,err := toEscape(f.Escape)
+		if err!=nil { return tFalse,err }
+		return tri(Like(string(s),string(p),e) == (f.Operator=="like")),nil
+	case "regexp","not regexp":
+		if v==nil || f.Value==nil { return tNull,nil }
+		s,ok1 := asText(v)
+		p,ok2 := asText(f.Value)
+		if !ok1 { s = []byte(fmt.Sprint(v)) }
+		if !ok2 { return tFalse,f.Err(table.E_FILTER_OPERATOR_UNSUPP,nil) }
+		re,err := m.regexp(string(p))
+		if err!=nil { return tFalse,err }
+		return tri(re.Match(s) == (f.Operator=="regexp")),nil
+	case "in","not in":
+		list,ok := f.Value.([]interface{})
+		if !ok { list = []interface{}{f.Value} }
+		if v==nil { return tNull,nil }
+		found,null := false,false
+		for _,e := range list {
+			if e==nil { null = true; continue }
+			c,err := Compare(v,e)
+			if err!=nil { return tFalse,err }
+			if c==0 { found = true; break }
+		}
+		switch {
+		case found: return tri(f.Operator=="in"),nil
+		case null: return tNull,nil
+		}
+		return tri(f.Operator=="not in"),nil
+	}
+	return tFalse,f.Err(table.E_FILTER_OPERATOR_UNSUPP,nil)
+}
+
+// Evaluates the filters onto 'cols'/'vals'. Every column referenced by the filters must be in 'cols'.
+func (m *Matcher) MatchAll(filter []table.ColumnFilter,cols []int,vals []interface{}) (bool,error) {
+	for i := range filter {
+		f := &filter[i]
+		p := indexOf(cols,f.Index)
+		if p<0 { return false,f.Err(table.E_FILTER_FIELD_UNSUPP,nil) }
+		ok,err := m.Match(f,vals[p])
+		if !ok || err!=nil { return false,err }
+	}
+	return true,nil
+}
+
+// Evaluates the predicate tree onto 'cols'/'vals'. A nil predicate is true.
+func (m *Matcher) MatchPredicate(p *table.Predicate,cols []int,vals []interface{}) (bool,error) {
+	if p==nil { return true,nil }
+	t,err := m.eval3(p,cols,vals)
+	return t==tTrue,err
+}
+func (m *Matcher) eval3(p *table.Predicate,cols []int,vals []interface{}) (int8,error) {
+	switch p.Op {
+	case table.P_FILTER:
+		i := indexOf(cols,p.Filter.Index)
+		if i<0 { return tFalse,p.Filter.Err(table.E_FILTER_FIELD_UNSUPP,nil) }
+		return m.match3(&p.Filter,vals[i])
+	case table.P_EXPR:
+		v,err := m.Eval(p.Expr,cols,vals)
+		if err!=nil { return tFalse,err }
+		return truth(v)
+	case table.P_NOT:
+		if len(p.Args)!=1 { break }
+		t,err := m.eval3(p.Args[0],cols,vals)
+		switch t {
+		case tTrue: t = tFalse
+		case tFalse: t = tTrue
+		}
+		return t,err
+	case table.P_AND,table.P_OR:
+		// AND: false dominates, OR: true dominates.
+		dom,res := tFalse,tTrue
+		if p.Op==table.P_OR { dom,res = tTrue,tFalse }
+		for _,a := range p.Args {
+			t,err := m.eval3(a,cols,vals)
+			if err!=nil { return tFalse,err }
+			if t==dom { return dom,nil }
+			if t==tNull { res = tNull }
+		}
+		return res,nil
+	}
+	return tFalse,fmt.Errorf("invalid predicate %v",p)
+}
+
+// Appends the columns, referenced by the predicate, to 'cols' unless already present.
+func PredicateColumns(cols []int,p *table.Predicate) []int {
+	p.Walk(func(f *table.ColumnFilter) {
+		if indexOf(cols,f.Index)<0 { cols = append(cols,f.Index) }
+	})
+	p.WalkExpr(func(e *table.Expression) {
+		if e.Op==table.E_COLUMN && indexOf(cols,e.Index)<0 { cols = append(cols,e.Index) }
+	})
+	return cols
+}
+
+// Returns true, if the table evaluates TableScan.Where itself.
+func ScansPredicates(tab table.Table) bool {
+	pt,ok := tab.(table.PredicateTable)
+	return ok && pt.ScanPredicates()
+}
+
+func indexOf(cols []int,i int) int {
+	for p,j := range cols { if i==j { return p } }
+	return -1
+}
+
+// Evaluates the residual filters over the rows of the underlying iterator.
+type residualIterator struct {
+	table.TableIterator
+	cols []int
+	vals []interface{}
+	residual []table.ColumnFilter
+	where *table.Predicate
+	m Matcher
+}
+func (r *residualIterator) Next(cols []int,vals []interface{}) error {
+	for {
+		err := r.TableIterator.Next(r.cols,r.vals)
+		if err!=nil { return err }
+		ok,err := r.m.MatchAll(r.residual,r.cols,r.vals)
+		if err!=nil { return err }
+		if ok { ok,err = r.m.MatchPredicate(r.where,r.cols,r.vals) }
+		if err!=nil { return err }
+		if ok { break }
+	}
+	copy(vals,r.vals)
+	return nil
+}
+
+func rejects(f *table.ColumnFilter,se *table.ScanError) bool {
+	switch se.ErrCode {
+	case table.E_FILTER_FIELD_UNSUPP: return f.Index==se.FieldIndex
+	case table.E_FILTER_OPERATOR_UNSUPP: return f.Operator==se.Operator
+	case table.E_FILTER_OPERATOR_FIELD: return f.Index==se.FieldIndex && f.Operator==se.Operator
+	}
+	return false
+}
+
+/*
+Splits the scan into the part, that is pushed down onto the table, and the
+filters and predicate, that are evaluated over the rows. Unless the table
+implements table.ScanCapableTable, every filter is tentatively pushed down.
+*/
+func SplitScan(tab table.Table,meta *table.TableScan) (pushed table.TableScan,residual []table.ColumnFilter,where *table.Predicate) {
+	pushed = *meta
+	pushed.Filter = append([]table.ColumnFilter(nil),meta.Filter...)
+	if ctab,ok := tab.(table.ScanCapableTable); ok {
+		pushed.Filter,residual = table.SplitFilter(ctab.ScanCaps(),meta.Filter)
+	}
+	if meta.Where!=nil && !ScansPredicates(tab) {
+		pushed.Where,where = nil,meta.Where
+	}
+	return
+}
+
+/*
+Performs a table scan, pushing down every filter the table accepts, and
+evaluating the remaining ones over the rows, returned by the table.
+
+If the table implements table.ScanCapableTable, the filters are split up
+front. Otherwise, a filter is considered rejected, if the table returns a
+table.ScanError with a filter-related ErrCode, that matches the filter's
+field and/or operator.
+
+The predicate tree TableScan.Where is only pushed down to tables, for which
+ScansPredicates() is true, and evaluated over the rows otherwise.
+
+If there are residual filters, Limit and Offset are not pushed down, and the
+returned iterator does not implement table.LimitingIterator.
+*/
+func ResidualScan(tab table.Table,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	return ResidualScanContext(context.Background(),tab,cols,meta)
+}
+
+// Like ResidualScan, but the scan stops with ctx.Err(), once 'ctx' is done.
+func ResidualScanContext(ctx context.Context,tab table.Table,cols []int,meta *table.TableScan) (table.TableIterator,error) {
+	pushed,residual,where := SplitScan(tab,meta)
+	for {
+		scols := cols
+		if len(residual)!=0 || where!=nil {
+			pushed.Limit,pushed.Offset = nil,nil
+			scols = append([]int(nil),cols...)
+			for _,f := range residual {
+				if indexOf(scols,f.Index)<0 { scols = append(scols,f.Index) }
+			}
+			scols = PredicateColumns(scols,where)
+		}
+		iter,err := ScanContext(ctx,tab,scols,&pushed)
+		if err==nil {
+			if len(residual)==0 && where==nil { return iter,nil }
+			return &residualIterator{TableIterator:iter,cols:scols,vals:make([]interface{},len(scols)),residual:residual,where:where},nil
+		}
+		var se *table.ScanError
+		switch v := err.(type) {
+		case table.ScanError: se = &v
+		case *table.ScanError: se = v
+		default: return nil,err
+		}
+		rest := pushed.Filter[:0]
+		for _,f := range pushed.Filter {
+			if rejects(&f,se) {
+				residual = append(residual,f)
+			} else {
+				rest = append(rest,f)
+			}
+		}
+		if len(rest)==len(pushed.Filter) { return nil,err }
+		pushed.Filter = rest
+	}
+}
@@ -24,15 +24,41 @@ SOFTWARE.
 package util
 
 import (
+	"github.com/mad-day/db-utils/table"
+	"encoding/binary"
 	"reflect"
 	"fmt"
+	"strings"
 	"time"
 )
 
+// Encodes an integer key, so that the byte order of the keys matches their numeric order.
+func EncodeIntKey(i int64) []byte {
+	b := make([]byte,8)
+	binary.BigEndian.PutUint64(b,uint64(i)^(1<<63))
+	return b
+}
+func DecodeIntKey(b []byte) (int64,error) {
+	if len(b)!=8 { return 0,fmt.Errorf("invalid integer key of length %d",len(b)) }
+	return int64(binary.BigEndian.Uint64(b)^(1<<63)),nil
+}
+
+// Returns the key encoding of a value, if it has one. See GetKey.
+func KeyOf(val interface{}) ([]byte,bool) {
+	switch v := val.(type) {
+	case []byte: return v,true
+	case string: return []byte(v),true
+	case int64: return EncodeIntKey(v),true
+	case int: return EncodeIntKey(int64(v)),true
+	}
+	return nil,false
+}
+
 func GetKey(dest interface{}) ([]byte,error){
 	switch v := dest.(type) {
 	case *string: return []byte(*v),nil
 	case *[]byte: return *v,nil
+	case *int64: return EncodeIntKey(*v),nil
 	default: return nil,fmt.Errorf("Invalid assignment %T <- []byte",dest)
 	}
 	panic("unreachable")
@@ -42,6 +68,10 @@ func SetInKey(dest interface{}, val []byte) error{
 	switch v := dest.(type) {
 	case *string: *v = string(val)
 	case *[]byte: *v = val
+	case *int64:
+		i,err := DecodeIntKey(val)
+		if err!=nil { return err }
+		*v = i
 	default: return fmt.Errorf("Invalid assignment %T <- []byte",dest)
 	}
 	return nil
@@ -169,3 +199,47 @@ func (v ValueType) Type() reflect.Type {
 	return t
 }
 
+
+// Returns the ValueType of a reflect.Type, if there is one.
+func ValueTypeOf(t reflect.Type) (ValueType,bool) {
+	for v,vt := range vt_map {
+		if vt==t { return v,true }
+	}
+	return 0,false
+}
+
+var vt_names = map[ValueType]string {
+	VT_INT: "BIGINT",
+	VT_FLOAT: "DOUBLE",
+	VT_BOOL: "BOOLEAN",
+	VT_BYTES: "BLOB",
+	VT_STRING: "TEXT",
+	VT_TIMESTAMP: "TIMESTAMP",
+}
+
+// Returns the SQL type name of the ValueType.
+func (v ValueType) DatabaseTypeName() string {
+	n,ok := vt_names[v]
+	if !ok { panic("invalid/undefined ValueType") }
+	return n
+}
+
+// Returns the table.ColumnType of a column of the ValueType.
+func (v ValueType) ColumnType(nullable bool) table.ColumnType {
+	return table.ColumnType{ScanType:v.Type(),DatabaseTypeName:v.DatabaseTypeName(),Nullable:nullable,NullableKnown:true}
+}
+
+var vt_sqltypes = map[string]ValueType {
+	"tinyint": VT_INT, "smallint": VT_INT, "mediumint": VT_INT, "int": VT_INT, "integer": VT_INT, "bigint": VT_INT, "bit": VT_INT, "year": VT_INT,
+	"float": VT_FLOAT, "double": VT_FLOAT, "real": VT_FLOAT, "decimal": VT_FLOAT, "numeric": VT_FLOAT,
+	"bool": VT_BOOL, "boolean": VT_BOOL,
+	"binary": VT_BYTES, "varbinary": VT_BYTES, "tinyblob": VT_BYTES, "blob": VT_BYTES, "mediumblob": VT_BYTES, "longblob": VT_BYTES,
+	"char": VT_STRING, "varchar": VT_STRING, "tinytext": VT_STRING, "text": VT_STRING, "mediumtext": VT_STRING, "longtext": VT_STRING, "enum": VT_STRING, "set": VT_STRING, "json": VT_STRING,
+	"date": VT_TIMESTAMP, "time": VT_TIMESTAMP, "datetime": VT_TIMESTAMP, "timestamp": VT_TIMESTAMP,
+}
+
+// Returns the ValueType of an SQL column type, such as "varchar" or "bigint", if there is one.
+func ValueTypeByName(sqltype string) (ValueType,bool) {
+	v,ok := vt_sqltypes[strings.ToLower(sqltype)]
+	return v,ok
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2019 Simon Schmidt
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package util_test
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mad-day/db-utils/table"
+	"github.com/mad-day/db-utils/table/util"
+)
+
+var rows = [][]interface{}{
+	{int64(1), "apple", int64(3)},
+	{int64(2), "banana", int64(5)},
+	{int64(3), "cherry", int64(7)},
+}
+
+// A table, that only accepts "=" on column 0 and rejects anything else with a table.ScanError.
+type restricted struct {
+	scans []table.TableScan
+}
+
+func (t *restricted) Columns() []string { return []string{"id", "name", "qty"} }
+func (t *restricted) TableScan(cols []int, meta *table.TableScan) (table.TableIterator, error) {
+	t.scans = append(t.scans, *meta)
+	if meta.Where != nil {
+		return nil, table.ErrPredicateUnsupp
+	}
+	var sel [][]interface{}
+	for i := range meta.Filter {
+		f := &meta.Filter[i]
+		if f.Index != 0 {
+			return nil, f.Err(table.E_FILTER_FIELD_UNSUPP, t.Columns())
+		}
+		if f.Operator != "=" {
+			return nil, f.Err(table.E_FILTER_OPERATOR_UNSUPP, t.Columns())
+		}
+	}
+	var m util.Matcher
+	all := []int{0, 1, 2}
+	for _, r := range rows {
+		if ok, err := m.MatchAll(meta.Filter, all, r); err != nil {
+			return nil, err
+		} else if ok {
+			sel = append(sel, r)
+		}
+	}
+	return &iter{cols: cols, rows: sel}, nil
+}
+
+type iter struct {
+	cols []int
+	rows [][]interface{}
+}
+
+func (it *iter) Close() error { return nil }
+func (it *iter) Next(cols []int, vals []interface{}) error {
+	if len(it.rows) == 0 {
+		return io.EOF
+	}
+	for i, c := range cols {
+		vals[i] = it.rows[0][c]
+	}
+	it.rows = it.rows[1:]
+	return nil
+}
+
+func names(t *testing.T, it table.TableIterator, err error) []string {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var res []string
+	vals := make([]interface{}, 1)
+	for {
+		err := it.Next([]int{1}, vals)
+		if err == io.EOF {
+			return res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, vals[0].(string))
+	}
+}
+
+func TestResidualScan(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		meta table.TableScan
+		want []string
+	}{
+		{"key", table.TableScan{Filter: []table.ColumnFilter{{Index: 0, Operator: "=", Value: int64(2)}}}, []string{"banana"}},
+		{"field", table.TableScan{Filter: []table.ColumnFilter{{Index: 2, Operator: ">", Value: int64(4)}}}, []string{"banana", "cherry"}},
+		{"operator", table.TableScan{Filter: []table.ColumnFilter{{Index: 0, Operator: "!=", Value: int64(2)}}}, []string{"apple", "cherry"}},
+		{"both", table.TableScan{Filter: []table.ColumnFilter{
+			{Index: 0, Operator: "=", Value: int64(3)},
+			{Index: 1, Operator: "like", Value: "c%"},
+		}}, []string{"cherry"}},
+		{"where", table.TableScan{Where: &table.Predicate{Op: table.P_OR, Args: []*table.Predicate{
+			{Op: table.P_FILTER, Filter: table.ColumnFilter{Index: 1, Operator: "=", Value: "apple"}},
+			{Op: table.P_FILTER, Filter: table.ColumnFilter{Index: 2, Operator: "=", Value: int64(7)}},
+		}}}, []string{"apple", "cherry"}},
+	} {
+		// Without ScanCaps, rejected filters are found by the errors of the table.
+		for _, tab := range []table.Table{new(restricted), capsTable{new(restricted)}} {
+			meta := c.meta
+			it, err := util.ResidualScan(tab, []int{1}, &meta)
+			if got := names(t, it, err); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s %T: got %v, want %v", c.name, tab, got, c.want)
+			}
+		}
+	}
+}
+
+// With residual filters, the limit is left to the caller.
+func TestResidualLimit(t *testing.T) {
+	tab := new(restricted)
+	meta := &table.TableScan{Filter: []table.ColumnFilter{{Index: 2, Operator: ">", Value: int64(0)}}, Limit: int64(1)}
+	it, err := util.ResidualScan(tab, []int{1}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if li, ok := it.(table.LimitingIterator); ok && li.LimitApplied() {
+		t.Error("residual iterator claims to apply the limit")
+	}
+	last := tab.scans[len(tab.scans)-1]
+	if last.Limit != nil || len(last.Filter) != 0 {
+		t.Errorf("pushed down: %v", last)
+	}
+}